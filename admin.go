@@ -0,0 +1,108 @@
+// Package onerpc serves and calls the grpc services, with the interceptors, the gateway and the admin server.
+//
+// Breaking change: the prometheus exporter on :9095 started with PROMETHEUS_ENABLED is removed, the metrics
+// are served by the admin server, on MetricsUrl of the rpc server, or :9095 by default. The processes with
+// only the clients call StartAdmin to serve theirs, see CHANGELOG.md.
+package onerpc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wednesdaysunny/onerpc/eco/admin"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"github.com/wednesdaysunny/onerpc/eco/interceptor"
+)
+
+const (
+	defaultAdminAddr = ":9095"
+	adminStopTimeout = time.Second
+)
+
+var errAdminStarted = errors.New("admin server started already")
+
+var (
+	adminLock    sync.Mutex
+	adminStarted bool
+)
+
+// StartAdmin starts the admin server of a process without rpc servers, like the ones with only the clients,
+// serving the metrics, pprof and the probes on addr, host:port or a url like http://0.0.0.0:9095/metrics,
+// or :9095 by default, where the metrics of the clients were served by the prometheus exporter.
+// It's started once in a process, the rpc servers skip theirs if started already. The returned func stops it.
+func StartAdmin(addr string) (func(), error) {
+	server, err := startAdminServer(addr, func(server *admin.Server) {})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), adminStopTimeout)
+		defer cancel()
+		server.Stop(ctx)
+	}, nil
+}
+
+// startAdmin starts the admin server of the process with the first server started, it listens on
+// MetricsUrl, or :9095 by default, and stops with the shutdown listeners of the server.
+func (rs *RpcServer) startAdmin() {
+	server, err := startAdminServer(rs.conf.MetricsUrl, func(server *admin.Server) {
+		server.Handle(CatalogPath, rs.CatalogHandler())
+		server.SetReadiness(rs.health.Ready)
+		server.SetConfig(rs.conf)
+	})
+	// the rpc server keeps serving without the admin server
+	if err == errAdminStarted {
+		return
+	} else if err != nil {
+		oc.LogErrorc("admin", err, "fail to start the admin server")
+		return
+	}
+
+	rs.server.AddShutdownListener(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), adminStopTimeout)
+		defer cancel()
+		server.Stop(ctx)
+	})
+}
+
+// startAdminServer starts the admin server serving the metrics and the handlers of setup, or returns
+// errAdminStarted if started already in the process.
+func startAdminServer(addr string, setup func(server *admin.Server)) (*admin.Server, error) {
+	adminLock.Lock()
+	defer adminLock.Unlock()
+	if adminStarted {
+		return nil, errAdminStarted
+	}
+
+	server := admin.NewServer(adminAddr(addr))
+	server.Handle(admin.PathMetrics, interceptor.MetricsHandler())
+	setup(server)
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	adminStarted = true
+	return server, nil
+}
+
+// adminAddr returns the address of MetricsUrl, which is host:port or a url like http://0.0.0.0:9095/metrics.
+func adminAddr(metricsUrl string) string {
+	if len(metricsUrl) == 0 {
+		return defaultAdminAddr
+	}
+	if !strings.Contains(metricsUrl, "://") {
+		return metricsUrl
+	}
+
+	u, err := url.Parse(metricsUrl)
+	if err != nil || len(u.Host) == 0 {
+		return defaultAdminAddr
+	}
+
+	return u.Host
+}
@@ -0,0 +1,52 @@
+package onerpc
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wednesdaysunny/onerpc/eco/admin"
+)
+
+func TestStartAdmin(t *testing.T) {
+	defer func() {
+		adminLock.Lock()
+		adminStarted = false
+		adminLock.Unlock()
+	}()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	stop, err := StartAdmin("http://" + addr + admin.PathMetrics)
+	assert.Nil(t, err)
+	defer stop()
+
+	resp, err := http.Get("http://" + addr + admin.PathMetrics)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// once in a process
+	_, err = StartAdmin(addr)
+	assert.Equal(t, errAdminStarted, err)
+}
+
+func TestAdminAddr(t *testing.T) {
+	tests := []struct {
+		metricsUrl string
+		addr       string
+	}{
+		{metricsUrl: "", addr: defaultAdminAddr},
+		{metricsUrl: ":9100", addr: ":9100"},
+		{metricsUrl: "http://0.0.0.0:9100/metrics", addr: "0.0.0.0:9100"},
+		{metricsUrl: "http://", addr: defaultAdminAddr},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.addr, adminAddr(test.metricsUrl))
+	}
+}
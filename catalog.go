@@ -0,0 +1,136 @@
+package onerpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/wednesdaysunny/onerpc/eco/interceptor"
+	"google.golang.org/grpc"
+)
+
+const (
+	// CatalogPath is the path of the method catalog on the admin server
+	CatalogPath = "/debug/rpc/methods"
+
+	KindUnary        = "unary"
+	KindClientStream = "client_stream"
+	KindServerStream = "server_stream"
+	KindBidiStream   = "bidi_stream"
+)
+
+type (
+	// MethodFeatures is the onerpc features active for a method.
+	MethodFeatures struct {
+		Cache         string `json:"cache,omitempty"` // the cache expiration
+		CacheAnonOnly bool   `json:"cache_anon_only,omitempty"`
+		Timeout       string `json:"timeout,omitempty"`
+		Auth          string `json:"auth,omitempty"` // strict or permissive
+	}
+
+	MethodEntry struct {
+		Method   string         `json:"method"` // the full method, like /package.service/method
+		Kind     string         `json:"kind"`
+		Features MethodFeatures `json:"features"`
+	}
+
+	ServiceEntry struct {
+		Service  string        `json:"service"`
+		Metadata interface{}   `json:"metadata,omitempty"`
+		Methods  []MethodEntry `json:"methods"`
+	}
+)
+
+// Catalog lists the registered services and methods, sorted by name, which is empty before Start.
+func (rs *RpcServer) Catalog() []ServiceEntry {
+	server := rs.GetGrpcServer()
+	if server == nil {
+		return nil
+	}
+
+	var services []ServiceEntry
+	for name, info := range server.GetServiceInfo() {
+		service := ServiceEntry{
+			Service:  name,
+			Metadata: info.Metadata,
+		}
+		for _, method := range info.Methods {
+			fullMethod := "/" + name + "/" + method.Name
+			service.Methods = append(service.Methods, MethodEntry{
+				Method:   fullMethod,
+				Kind:     methodKind(method),
+				Features: rs.methodFeatures(fullMethod, method.IsClientStream || method.IsServerStream),
+			})
+		}
+		sort.Slice(service.Methods, func(i, j int) bool {
+			return service.Methods[i].Method < service.Methods[j].Method
+		})
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Service < services[j].Service
+	})
+
+	return services
+}
+
+// CatalogHandler serves the catalog in json, which is served at CatalogPath
+// on the admin server after Start as well.
+func (rs *RpcServer) CatalogHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rs.Catalog()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (rs *RpcServer) methodFeatures(fullMethod string, stream bool) MethodFeatures {
+	var features MethodFeatures
+	// the cache only works on the unary calls
+	if !stream && rs.server.HasInterceptor(InterceptorCache) {
+		if setting, ok := interceptor.CacheSettingOf(fullMethod); ok {
+			features.Cache = setting.Expiration.String()
+			features.CacheAnonOnly = setting.AnonOnly
+		}
+	}
+	if rs.server.HasInterceptor(InterceptorTimeout) {
+		var (
+			timeout time.Duration
+			methods map[string]time.Duration
+		)
+		if stream {
+			_, timeout, methods = streamTimeouts(rs.conf)
+		} else {
+			timeout, methods = serverTimeouts(rs.conf)
+		}
+		if t := interceptor.TimeoutFor(fullMethod, timeout, methods); t > 0 {
+			features.Timeout = t.String()
+		}
+	}
+	if rs.conf.Auth && rs.server.HasInterceptor(InterceptorAuth) && !interceptor.IsAuthExempt(fullMethod) {
+		if rs.conf.StrictControl {
+			features.Auth = "strict"
+		} else {
+			features.Auth = "permissive"
+		}
+	}
+
+	return features
+}
+
+func methodKind(method grpc.MethodInfo) string {
+	switch {
+	case method.IsClientStream && method.IsServerStream:
+		return KindBidiStream
+	case method.IsClientStream:
+		return KindClientStream
+	case method.IsServerStream:
+		return KindServerStream
+	default:
+		return KindUnary
+	}
+}
@@ -0,0 +1,130 @@
+package onerpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func newCatalogServer(t *testing.T) *RpcServer {
+	rs, err := NewServer(oconf.RpcServerConf{
+		Name:          "catalog",
+		ListenOn:      "127.0.0.1:0",
+		Auth:          true,
+		StrictControl: true,
+		Timeout:       2,
+		Timeouts:      map[string]int64{"/grpc.health.v1.Health/Check": 500},
+		StreamTimeout: 60,
+	}, func(server *grpc.Server) {})
+	assert.Nil(t, err)
+
+	return rs
+}
+
+func TestCatalog(t *testing.T) {
+	rs := newCatalogServer(t)
+	// nothing registered before the grpc server is built
+	assert.Nil(t, rs.Catalog())
+
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	rs.SetGrpcServer(server)
+
+	catalog := rs.Catalog()
+	assert.Equal(t, 2, len(catalog))
+	assert.Equal(t, "grpc.health.v1.Health", catalog[0].Service)
+	assert.Equal(t, "grpc.reflection.v1alpha.ServerReflection", catalog[1].Service)
+
+	methods := make(map[string]MethodEntry)
+	for _, service := range catalog {
+		for _, method := range service.Methods {
+			methods[method.Method] = method
+		}
+	}
+	tests := []struct {
+		method   string
+		kind     string
+		features MethodFeatures
+	}{
+		{
+			method:   "/grpc.health.v1.Health/Check",
+			kind:     KindUnary,
+			features: MethodFeatures{Timeout: "500ms"},
+		},
+		{
+			method:   "/grpc.health.v1.Health/Watch",
+			kind:     KindServerStream,
+			features: MethodFeatures{Timeout: "1m0s"},
+		},
+		{
+			method:   "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+			kind:     KindBidiStream,
+			features: MethodFeatures{Timeout: "1m0s", Auth: "strict"},
+		},
+	}
+
+	assert.Equal(t, len(tests), len(methods))
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			method, ok := methods[test.method]
+			assert.True(t, ok)
+			assert.Equal(t, test.kind, method.Kind)
+			assert.Equal(t, test.features, method.Features)
+		})
+	}
+
+	// the sorted methods of a service
+	assert.Equal(t, "/grpc.health.v1.Health/Check", catalog[0].Methods[0].Method)
+	assert.Equal(t, "/grpc.health.v1.Health/Watch", catalog[0].Methods[1].Method)
+}
+
+func TestCatalogFeatures(t *testing.T) {
+	rs := newCatalogServer(t)
+	tests := []struct {
+		name     string
+		remove   string
+		method   string
+		stream   bool
+		features MethodFeatures
+	}{
+		{name: "unary", method: "/pkg.Svc/Get", features: MethodFeatures{Timeout: "2s", Auth: "strict"}},
+		{name: "stream", method: "/pkg.Svc/Watch", stream: true, features: MethodFeatures{Timeout: "1m0s", Auth: "strict"}},
+		{name: "auth exempt", method: "/grpc.health.v1.Health/Check", features: MethodFeatures{Timeout: "500ms"}},
+		{name: "no timeout", remove: InterceptorTimeout, method: "/pkg.Svc/Get", features: MethodFeatures{Auth: "strict"}},
+		{name: "no auth", remove: InterceptorAuth, method: "/pkg.Svc/Get"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.remove) > 0 {
+				rs.RemoveInterceptor(test.remove)
+			}
+			assert.Equal(t, test.features, rs.methodFeatures(test.method, test.stream))
+		})
+	}
+}
+
+func TestCatalogHandler(t *testing.T) {
+	rs := newCatalogServer(t)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	rs.SetGrpcServer(server)
+
+	w := httptest.NewRecorder()
+	rs.CatalogHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, CatalogPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var catalog []ServiceEntry
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &catalog))
+	assert.Equal(t, rs.Catalog(), catalog)
+}
@@ -3,6 +3,9 @@ package onerpc
 import (
 	"fmt"
 	"github.com/wednesdaysunny/onerpc/eco"
+	"github.com/wednesdaysunny/onerpc/eco/credential"
+	"github.com/wednesdaysunny/onerpc/eco/discov"
+	"github.com/wednesdaysunny/onerpc/eco/interceptor"
 	"log"
 	"time"
 
@@ -15,6 +18,7 @@ type (
 
 	Client interface {
 		Conn() *grpc.ClientConn
+		ClientConn() grpc.ClientConnInterface
 	}
 
 	RpcClient struct {
@@ -39,6 +43,37 @@ func NewClient(c oconf.RpcClientConf, options ...eco.ClientOption) (Client, erro
 	if c.PollSize > 0 {
 		opts = append(opts, eco.WithPollSize(int(c.PollSize)))
 	}
+	if len(c.PoolPolicy) > 0 {
+		opts = append(opts, eco.WithPoolPolicy(c.PoolPolicy))
+	}
+	if c.HasCredential() {
+		opts = append(opts, eco.WithDialOption(grpc.WithPerRPCCredentials(credential.NewAppCredential(c.App, c.Token))))
+	}
+	if c.TLS.Enabled() {
+		creds, err := credential.NewClientTLS(c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, eco.WithTransportCredentials(creds))
+	}
+	if len(c.BreakerCodes) > 0 {
+		failureCodes, err := interceptor.BreakerCodesFromConf(c.BreakerCodes)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, eco.WithBreakerCodes(failureCodes...))
+	}
+	for _, retry := range c.Retries {
+		policy, err := interceptor.RetryPolicyFromConf(retry)
+		if err != nil {
+			return nil, err
+		}
+		method := retry.Method
+		if len(method) == 0 {
+			method = interceptor.AnyMethod
+		}
+		opts = append(opts, eco.WithRetry(method, policy))
+	}
 
 	opts = append(opts, options...)
 
@@ -47,7 +82,12 @@ func NewClient(c oconf.RpcClientConf, options ...eco.ClientOption) (Client, erro
 		err         error
 		serviceName = oconf.GenServiceName(c.Name)
 	)
-	if serviceName != "" {
+	if c.Discov.Enabled() {
+		if _, err = discov.SetupRegistry(c.Discov); err != nil {
+			return nil, err
+		}
+		client, err = eco.NewClient(eco.BuildDiscovTarget(c.Name), opts...)
+	} else if serviceName != "" {
 		port := oconf.GenServicePort(c.Name)
 		target := fmt.Sprintf("%s:%d", serviceName, port)
 		client, err = eco.NewClient(target, opts...)
@@ -71,6 +111,10 @@ func (rc *RpcClient) Conn() *grpc.ClientConn {
 	return rc.client.Conn()
 }
 
+func (rc *RpcClient) ClientConn() grpc.ClientConnInterface {
+	return rc.client.ClientConn()
+}
+
 // 端到端client
 func NewDirectClientConf(endpoints []string, app, token string) oconf.RpcClientConf {
 	return oconf.RpcClientConf{
@@ -80,6 +124,14 @@ func NewDirectClientConf(endpoints []string, app, token string) oconf.RpcClientC
 	}
 }
 
+// 注册中心服务发现
+func NewDiscovClientConf(name string, discovConf oconf.DiscovConf) oconf.RpcClientConf {
+	return oconf.RpcClientConf{
+		Name:   name,
+		Discov: discovConf,
+	}
+}
+
 // istio 服务发现
 func NewIstioClientConf(name string) oconf.RpcClientConf {
 	return oconf.RpcClientConf{}
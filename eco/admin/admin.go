@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+const (
+	PathMetrics  = "/metrics"
+	PathPprof    = "/debug/pprof/"
+	PathHealthz  = "/healthz"
+	PathReadyz   = "/readyz"
+	PathConfig   = "/config"
+	PathLogLevel = "/loglevel"
+)
+
+// Server is the admin http server of the process, serving the pprof, the liveness and readiness probes,
+// the redacted config and the log level, along with the handlers added by Handle, like the metrics.
+// The other paths fall back to the http.DefaultServeMux.
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+	ready  func() error
+	conf   interface{}
+}
+
+func NewServer(addr string) *Server {
+	s := &Server{
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc(PathPprof, pprof.Index)
+	s.mux.HandleFunc(PathPprof+"cmdline", pprof.Cmdline)
+	s.mux.HandleFunc(PathPprof+"profile", pprof.Profile)
+	s.mux.HandleFunc(PathPprof+"symbol", pprof.Symbol)
+	s.mux.HandleFunc(PathPprof+"trace", pprof.Trace)
+	s.mux.HandleFunc(PathHealthz, s.healthz)
+	s.mux.HandleFunc(PathReadyz, s.readyz)
+	s.mux.HandleFunc(PathConfig, s.config)
+	s.mux.HandleFunc(PathLogLevel, s.logLevel)
+	s.mux.Handle("/", http.DefaultServeMux)
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: s.mux,
+	}
+
+	return s
+}
+
+// Handle serves pattern with handler, call it before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// SetReadiness sets the check of PathReadyz, nil means ready, call it before Start.
+func (s *Server) SetReadiness(ready func() error) {
+	s.ready = ready
+}
+
+// SetConfig sets the config dumped at PathConfig, with the secrets redacted, call it before Start.
+func (s *Server) SetConfig(conf interface{}) {
+	s.conf = conf
+}
+
+// Start listens on the address and serves in background, the error of listening is returned.
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.server.Serve(lis); err != nil && err != http.ErrServerClosed {
+			oc.LogErrorc("admin", err, "fail to serve the admin server")
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the server, the in-flight requests are waited until ctx is done.
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if s.ready != nil {
+		if err := s.ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) config(w http.ResponseWriter, r *http.Request) {
+	if s.conf == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	conf, err := Redact(s.conf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, conf)
+}
+
+// logLevel returns the log level on GET, and sets it by the level parameter on PUT or POST.
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level := r.FormValue("level")
+		if err := oc.SetLogLevel(level); err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		oc.LogWarnLn("log level changed to", level, "from", r.RemoteAddr)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]string{"level": oc.GetLogLevel()})
+}
+
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+)
+
+func serve(s *Server, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestProbes(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, PathHealthz).Code)
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, PathReadyz).Code)
+
+	s.SetReadiness(func() error {
+		return errors.New("not serving")
+	})
+	w := serve(s, http.MethodGet, PathReadyz)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "not serving")
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, PathHealthz).Code)
+	assert.Equal(t, http.StatusOK, serve(s, http.MethodGet, PathPprof).Code)
+}
+
+func TestConfig(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	assert.Equal(t, http.StatusNotFound, serve(s, http.MethodGet, PathConfig).Code)
+
+	s.SetConfig(oconf.RpcServerConf{
+		Name:     "user",
+		Auth:     true,
+		AuthApps: map[string]string{"web": "token"},
+		Redis:    oconf.RedisConf{Host: "redis", Auth: "pass"},
+		Mysql:    oconf.MysqlConf{Username: "root", Password: "pass"},
+		Log:      oconf.ConfigLog{SentryDSN: "https://key@sentry"},
+	})
+	w := serve(s, http.MethodGet, PathConfig)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var conf map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &conf))
+	assert.Equal(t, "user", conf["name"])
+	assert.Equal(t, true, conf["auth"])
+	assert.Equal(t, map[string]interface{}{"web": redacted}, conf["auth_apps"])
+	assert.Equal(t, "redis", conf["redis"].(map[string]interface{})["host"])
+	assert.Equal(t, redacted, conf["redis"].(map[string]interface{})["auth"])
+	assert.Equal(t, "root", conf["mysql"].(map[string]interface{})["username"])
+	assert.Equal(t, redacted, conf["mysql"].(map[string]interface{})["password"])
+	assert.Equal(t, redacted, conf["log"].(map[string]interface{})["sentry_dsn"])
+}
+
+func TestLogLevel(t *testing.T) {
+	level := oc.GetLogLevel()
+	defer oc.SetLogLevel(level)
+
+	s := NewServer("127.0.0.1:0")
+	w := serve(s, http.MethodPut, PathLogLevel+"?level=debug")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "debug", oc.GetLogLevel())
+
+	w = serve(s, http.MethodGet, PathLogLevel)
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, serve(s, http.MethodPost, PathLogLevel+"?level=loud").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(s, http.MethodDelete, PathLogLevel).Code)
+	assert.Equal(t, "debug", oc.GetLogLevel())
+}
+
+func TestStartStop(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lis.Close()
+	assert.NotNil(t, NewServer(lis.Addr().String()).Start())
+
+	s := NewServer("127.0.0.1:0")
+	s.Handle(PathMetrics, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	}))
+	assert.Nil(t, s.Start())
+	assert.Equal(t, "metrics", serve(s, http.MethodGet, PathMetrics).Body.String())
+	assert.Nil(t, s.Stop(context.Background()))
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "******"
+
+// the yaml keys holding the secrets, all the strings under them are redacted, like the tokens of auth_apps
+var sensitiveKeys = []string{"auth", "password", "passwd", "secret", "token", "dsn"}
+
+// Redact converts conf to the map of its yaml keys, with the secrets redacted.
+func Redact(conf interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	m, ok := redact(raw, false).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("admin: %T is not a struct or map", conf)
+	}
+
+	return m, nil
+}
+
+func redact(v interface{}, sensitive bool) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for key, item := range val {
+			k := fmt.Sprint(key)
+			m[k] = redact(item, sensitive || isSensitive(k))
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(val))
+		for i, item := range val {
+			items[i] = redact(item, sensitive)
+		}
+		return items
+	case string:
+		if sensitive && len(val) > 0 {
+			return redacted
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, item := range sensitiveKeys {
+		if strings.Contains(key, item) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package breaker
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"github.com/wednesdaysunny/onerpc/eco/inter/toolkit/window"
+)
+
+const (
+	// 250ms per bucket, 10s in total
+	windowSize     = 40
+	bucketDuration = time.Millisecond * 250
+	// the bigger k is, the later the breaker starts to drop
+	k = 1.5
+	// don't drop anything until there are enough requests in the window
+	protection = 5
+)
+
+type (
+	// Acceptable tells whether the error is a client side error, which doesn't count as a failure.
+	Acceptable func(err error) bool
+
+	// Breaker is the adaptive throttle described in Google SRE,
+	// https://sre.google/sre-book/handling-overload/#eq2101
+	Breaker struct {
+		name   string
+		stat   *window.RollingWindow
+		random *rand.Rand
+		lock   sync.Mutex
+	}
+)
+
+var (
+	breakers     = make(map[string]*Breaker)
+	breakersLock sync.RWMutex
+)
+
+func NewBreaker(name string) *Breaker {
+	return &Breaker{
+		name:   name,
+		stat:   window.NewRollingWindow(windowSize, bucketDuration),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// GetBreaker returns the breaker of name, it's created on first use.
+func GetBreaker(name string) *Breaker {
+	breakersLock.RLock()
+	b, ok := breakers[name]
+	breakersLock.RUnlock()
+	if ok {
+		return b
+	}
+
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	if b, ok = breakers[name]; !ok {
+		b = NewBreaker(name)
+		breakers[name] = b
+	}
+
+	return b
+}
+
+// DoWithAcceptable calls req with the breaker of name.
+func DoWithAcceptable(name string, req func() error, acceptable Acceptable) error {
+	return GetBreaker(name).DoWithAcceptable(req, acceptable)
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// DoWithAcceptable calls req if the breaker allows, otherwise returns ErrServiceUnavailable immediately.
+func (b *Breaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
+	if !b.Allow() {
+		return std.ErrServiceUnavailable
+	}
+
+	err := req()
+	if acceptable(err) {
+		b.MarkSuccess()
+	} else {
+		b.MarkFailure()
+	}
+
+	return err
+}
+
+// Allow tells whether the next request should go, the caller should mark its result.
+func (b *Breaker) Allow() bool {
+	ratio := b.DropRatio()
+	if ratio <= 0 {
+		return true
+	}
+
+	b.lock.Lock()
+	drop := b.random.Float64() < ratio
+	b.lock.Unlock()
+	if drop {
+		// the dropped requests count as failures, so the breaker keeps dropping while the callee is down
+		b.MarkFailure()
+		return false
+	}
+
+	return true
+}
+
+func (b *Breaker) MarkSuccess() {
+	b.stat.Add(1)
+}
+
+func (b *Breaker) MarkFailure() {
+	b.stat.Add(0)
+}
+
+// DropRatio returns the probability that a request is dropped right now, in [0, 1).
+func (b *Breaker) DropRatio() float64 {
+	var accepts, total int64
+	b.stat.Reduce(func(bucket *window.Bucket) {
+		accepts += int64(bucket.Sum)
+		total += bucket.Count
+	})
+
+	weightedAccepts := k * float64(accepts)
+	return math.Max(0, (float64(total-protection)-weightedAccepts)/float64(total+1))
+}
@@ -0,0 +1,60 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+var errServer = errors.New("server error")
+
+func acceptable(err error) bool {
+	return err != errServer
+}
+
+func TestBreakerAllowsHealthyCalls(t *testing.T) {
+	b := NewBreaker("healthy")
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, b.DoWithAcceptable(func() error {
+			return nil
+		}, acceptable))
+	}
+	assert.Equal(t, float64(0), b.DropRatio())
+}
+
+func TestBreakerDropsFailingCalls(t *testing.T) {
+	var (
+		b       = NewBreaker("failing")
+		dropped int
+	)
+	for i := 0; i < 1000; i++ {
+		err := b.DoWithAcceptable(func() error {
+			return errServer
+		}, acceptable)
+		if std.IsIvankaErr(err, std.ErrServiceUnavailable) {
+			dropped++
+		}
+	}
+	assert.True(t, dropped > 900)
+	assert.True(t, b.DropRatio() > 0.9)
+}
+
+func TestBreakerIgnoresAcceptableErrors(t *testing.T) {
+	var (
+		b         = NewBreaker("acceptable")
+		errClient = errors.New("client error")
+	)
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, errClient, b.DoWithAcceptable(func() error {
+			return errClient
+		}, acceptable))
+	}
+}
+
+func TestGetBreaker(t *testing.T) {
+	assert.True(t, GetBreaker("a") == GetBreaker("a"))
+	assert.False(t, GetBreaker("a") == GetBreaker("b"))
+	assert.Equal(t, "a", GetBreaker("a").Name())
+}
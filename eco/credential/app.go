@@ -0,0 +1,168 @@
+package credential
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"sync"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// the app metadata is taken by the prometheus interceptors for the service name, so use our own keys
+	AppKey   = "x-auth-app"
+	TokenKey = "x-auth-token"
+)
+
+// the reasons of the calls failing the check
+const (
+	ReasonNoApp      = "no_app"
+	ReasonUnknownApp = "unknown_app"
+	ReasonWrongToken = "wrong_token"
+)
+
+// the warnings of the same app and reason are logged at most once in warnInterval in non-strict mode
+const warnInterval = time.Minute
+
+type (
+	// AppCredential attaches the app and token to every call.
+	AppCredential struct {
+		App   string
+		Token string
+	}
+
+	// Authenticator checks the app and token of the calls against the allowed apps.
+	Authenticator struct {
+		apps   map[string]string
+		strict bool
+		lock   sync.Mutex
+		warns  map[string]*warnState
+	}
+
+	// Rejection tells why a call fails the check, App is the app the caller claims, if any.
+	Rejection struct {
+		App    string
+		Reason string
+	}
+
+	warnState struct {
+		last       time.Time
+		suppressed int
+	}
+)
+
+var _ credentials.PerRPCCredentials = AppCredential{}
+
+func NewAppCredential(app, token string) AppCredential {
+	return AppCredential{
+		App:   app,
+		Token: token,
+	}
+}
+
+func (c AppCredential) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		AppKey:   c.App,
+		TokenKey: c.Token,
+	}, nil
+}
+
+func (c AppCredential) RequireTransportSecurity() bool {
+	return false
+}
+
+// NewAuthenticator creates an authenticator with apps as app -> token, the calls failing the check
+// are rejected in strict mode, and only logged otherwise, which helps to roll out the tokens.
+func NewAuthenticator(apps map[string]string, strict bool) *Authenticator {
+	return &Authenticator{
+		apps:   apps,
+		strict: strict,
+		warns:  make(map[string]*warnState),
+	}
+}
+
+// Authenticate checks the call and rejects it if failed, see Check and Reject.
+func (a *Authenticator) Authenticate(ctx context.Context) error {
+	if r := a.Check(ctx); r != nil {
+		return a.Reject(r)
+	}
+
+	return nil
+}
+
+// Check checks the app and token of the call, nil if passed.
+func (a *Authenticator) Check(ctx context.Context) *Rejection {
+	md, _ := metadata.FromIncomingContext(ctx)
+	app := firstValue(md, AppKey)
+	if len(app) == 0 {
+		return &Rejection{Reason: ReasonNoApp}
+	}
+	expect, ok := a.apps[app]
+	if !ok {
+		return &Rejection{App: app, Reason: ReasonUnknownApp}
+	}
+	if subtle.ConstantTimeCompare([]byte(expect), []byte(firstValue(md, TokenKey))) != 1 {
+		return &Rejection{App: app, Reason: ReasonWrongToken}
+	}
+
+	return nil
+}
+
+// Reject returns ErrIllegalToken in strict mode, or logs the warning and allows the call otherwise.
+// The warnings are logged at most once a minute for an allowed app with the same reason, and once
+// a minute for all the other apps, with the count of the suppressed ones.
+func (a *Authenticator) Reject(r *Rejection) error {
+	if a.strict {
+		return oc.ErrIllegalToken
+	}
+
+	key := r.Reason
+	if _, ok := a.apps[r.App]; ok {
+		key = r.App + "/" + r.Reason
+	}
+	a.lock.Lock()
+	state, ok := a.warns[key]
+	if !ok {
+		state = new(warnState)
+		a.warns[key] = state
+	}
+	now := time.Now()
+	if now.Sub(state.last) < warnInterval {
+		state.suppressed++
+		a.lock.Unlock()
+		return nil
+	}
+	suppressed := state.suppressed
+	state.last = now
+	state.suppressed = 0
+	a.lock.Unlock()
+
+	oc.LogWarnc("auth", r, fmt.Sprintf("unauthenticated call allowed in non-strict mode, %d like it suppressed",
+		suppressed))
+	return nil
+}
+
+func (r *Rejection) Error() string {
+	switch r.Reason {
+	case ReasonNoApp:
+		return "no app in call"
+	case ReasonUnknownApp:
+		return fmt.Sprintf("app %q not allowed", r.App)
+	case ReasonWrongToken:
+		return fmt.Sprintf("illegal token of app %q", r.App)
+	default:
+		return fmt.Sprintf("%s of app %q", r.Reason, r.App)
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+
+	return ""
+}
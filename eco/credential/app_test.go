@@ -0,0 +1,100 @@
+package credential
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthenticator(t *testing.T) {
+	apps := map[string]string{
+		"order": "secret",
+	}
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		strict bool
+		err    error
+	}{
+		{
+			name:   "no metadata",
+			strict: true,
+			err:    oc.ErrIllegalToken,
+		},
+		{
+			name:   "matched",
+			md:     metadata.Pairs(AppKey, "order", TokenKey, "secret"),
+			strict: true,
+		},
+		{
+			name:   "wrong token",
+			md:     metadata.Pairs(AppKey, "order", TokenKey, "guess"),
+			strict: true,
+			err:    oc.ErrIllegalToken,
+		},
+		{
+			name:   "unknown app",
+			md:     metadata.Pairs(AppKey, "user", TokenKey, "secret"),
+			strict: true,
+			err:    oc.ErrIllegalToken,
+		},
+		{
+			name: "non-strict",
+			md:   metadata.Pairs(AppKey, "user", TokenKey, "secret"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, test.md)
+			}
+			err := NewAuthenticator(apps, test.strict).Authenticate(ctx)
+			assert.Equal(t, test.err, err)
+		})
+	}
+}
+
+func TestAuthenticatorCheck(t *testing.T) {
+	a := NewAuthenticator(map[string]string{"order": "secret"}, false)
+	check := func(md metadata.MD) *Rejection {
+		return a.Check(metadata.NewIncomingContext(context.Background(), md))
+	}
+
+	assert.Nil(t, check(metadata.Pairs(AppKey, "order", TokenKey, "secret")))
+	assert.Equal(t, &Rejection{Reason: ReasonNoApp}, check(metadata.Pairs(TokenKey, "secret")))
+	assert.Equal(t, &Rejection{App: "user", Reason: ReasonUnknownApp}, check(metadata.Pairs(AppKey, "user")))
+	// a known app with a wrong token is told apart from the missing ones
+	assert.Equal(t, &Rejection{App: "order", Reason: ReasonWrongToken},
+		check(metadata.Pairs(AppKey, "order", TokenKey, "guess")))
+	assert.Equal(t, &Rejection{App: "order", Reason: ReasonWrongToken}, check(metadata.Pairs(AppKey, "order")))
+}
+
+func TestAuthenticatorWarns(t *testing.T) {
+	a := NewAuthenticator(map[string]string{"order": "secret"}, false)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, a.Reject(&Rejection{App: "order", Reason: ReasonWrongToken}))
+		assert.Nil(t, a.Reject(&Rejection{App: "user", Reason: ReasonUnknownApp}))
+		assert.Nil(t, a.Reject(&Rejection{App: "other", Reason: ReasonUnknownApp}))
+	}
+
+	// logged once for each allowed app and reason, and once for all the unknown apps
+	assert.Equal(t, 2, len(a.warns))
+	assert.Equal(t, 2, a.warns["order/"+ReasonWrongToken].suppressed)
+	assert.Equal(t, 5, a.warns[ReasonUnknownApp].suppressed)
+
+	a.warns[ReasonUnknownApp].last = time.Now().Add(-warnInterval)
+	assert.Nil(t, a.Reject(&Rejection{App: "user", Reason: ReasonUnknownApp}))
+	assert.Equal(t, 0, a.warns[ReasonUnknownApp].suppressed)
+}
+
+func TestAppCredential(t *testing.T) {
+	md, err := NewAppCredential("order", "secret").GetRequestMetadata(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{AppKey: "order", TokenKey: "secret"}, md)
+}
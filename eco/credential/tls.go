@@ -0,0 +1,273 @@
+package credential
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// the files are checked at most once in reloadInterval, on the handshakes
+const reloadInterval = time.Second * 10
+
+type (
+	// PeerIdentity is the identity in the verified certificate of the peer.
+	PeerIdentity struct {
+		CommonName string
+		DNSNames   []string
+		URIs       []string
+	}
+
+	certReloader struct {
+		conf      oconf.TLSConf
+		lock      sync.RWMutex
+		cert      *tls.Certificate
+		pool      *x509.CertPool
+		modTime   time.Time
+		lastCheck time.Time
+	}
+)
+
+// NewServerTLS creates the server side transport credentials, the client certificates are verified
+// against the CA file if given, and required if RequireClientCert is set.
+func NewServerTLS(c oconf.TLSConf) (credentials.TransportCredentials, error) {
+	if len(c.CertFile) == 0 || len(c.KeyFile) == 0 {
+		return nil, errors.New("tls: server requires both cert_file and key_file")
+	}
+	if c.RequireClientCert && len(c.CAFile) == 0 {
+		return nil, errors.New("tls: require_client_cert requires ca_file")
+	}
+
+	r, err := newCertReloader(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			cfg := &tls.Config{
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2"},
+			}
+			if c.RequireClientCert {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			} else if pool != nil {
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+
+			return cfg, nil
+		},
+	}), nil
+}
+
+// NewClientTLS creates the client side transport credentials, the certificate is sent
+// for the mutual TLS if given, and the server is verified against the CA file if given, by server_name
+// or the host of the target, set server_name if the certificate doesn't cover the ip of the target.
+func NewClientTLS(c oconf.TLSConf) (credentials.TransportCredentials, error) {
+	if (len(c.CertFile) == 0) != (len(c.KeyFile) == 0) {
+		return nil, errors.New("tls: cert_file and key_file must be set together")
+	}
+
+	r, err := newCertReloader(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert, _ := r.current(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+	if len(c.CAFile) > 0 {
+		// the roots can't be swapped in a tls.Config, so the verification is done here with the reloaded CA
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tls: server presented no certificate")
+			}
+
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+				return err
+			}
+
+			return verifyServerName(cs.PeerCertificates[0], cs.ServerName)
+		}
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// verifyServerName verifies that cert covers name, the server_name or the host of the target, like
+// 10.0.0.1 of direct:///10.0.0.1:8080, which is verified against the IP SANs of cert.
+func verifyServerName(cert *x509.Certificate, name string) error {
+	if len(name) == 0 {
+		return errors.New("tls: no server name to verify, set server_name")
+	}
+
+	ip := net.ParseIP(name)
+	if ip == nil {
+		return cert.VerifyHostname(name)
+	}
+	for _, candidate := range cert.IPAddresses {
+		if candidate.Equal(ip) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("tls: certificate of the server doesn't cover ip %s, set server_name to one of %v",
+		name, cert.DNSNames)
+}
+
+// PeerIdentityFromContext returns the identity of the verified client certificate in the server context.
+func PeerIdentityFromContext(ctx context.Context) (PeerIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return PeerIdentity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return PeerIdentity{}, false
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	identity := PeerIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+
+	return identity, true
+}
+
+func newCertReloader(c oconf.TLSConf) (*certReloader, error) {
+	r := &certReloader{
+		conf: c,
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// current returns the certificate and the CA pool, reloaded if the files changed.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.lock.RLock()
+	cert, pool, lastCheck := r.cert, r.pool, r.lastCheck
+	r.lock.RUnlock()
+	if time.Since(lastCheck) < reloadInterval {
+		return cert, pool
+	}
+
+	r.lock.Lock()
+	r.lastCheck = time.Now()
+	r.lock.Unlock()
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		oc.LogErrorc("tls", err, "fail to check the certificate files")
+		return cert, pool
+	}
+
+	r.lock.RLock()
+	changed := modTime.After(r.modTime)
+	r.lock.RUnlock()
+	if changed {
+		// keep serving with the old ones if the new files are broken, like half written
+		if err := r.load(modTime); err != nil {
+			oc.LogErrorc("tls", err, "fail to reload the certificate files")
+		} else {
+			oc.LogInfoc("tls", "certificate files reloaded")
+		}
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, r.pool
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	var (
+		cert *tls.Certificate
+		pool *x509.CertPool
+	)
+	if len(r.conf.CertFile) > 0 {
+		pair, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+	if len(r.conf.CAFile) > 0 {
+		content, err := ioutil.ReadFile(r.conf.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return fmt.Errorf("tls: no certificate found in %s", r.conf.CAFile)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = cert
+	r.pool = pool
+	r.modTime = modTime
+	r.lastCheck = time.Now()
+
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.conf.CertFile, r.conf.KeyFile, r.conf.CAFile} {
+		if len(file) == 0 {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
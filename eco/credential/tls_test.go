@@ -0,0 +1,188 @@
+package credential
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	writePem(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+
+	return &testCA{cert: cert, key: key, dir: dir}
+}
+
+func (ca *testCA) issue(t *testing.T, name string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+".key")
+	writePem(t, certFile, "CERTIFICATE", der)
+	writePem(t, keyFile, "EC PRIVATE KEY", keyDer)
+
+	return certFile, keyFile
+}
+
+func writePem(t *testing.T, file, typ string, der []byte) {
+	assert.Nil(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, "server.local", 2)
+	clientCert, clientKey := ca.issue(t, "client.local", 3)
+
+	serverCreds, err := NewServerTLS(oconf.TLSConf{
+		CertFile:          serverCert,
+		KeyFile:           serverKey,
+		CAFile:            filepath.Join(dir, "ca.pem"),
+		RequireClientCert: true,
+	})
+	assert.Nil(t, err)
+
+	var identity PeerIdentity
+	server := grpc.NewServer(grpc.Creds(serverCreds), grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			identity, _ = PeerIdentityFromContext(ctx)
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	call := func(c oconf.TLSConf) error {
+		creds, err := NewClientTLS(c)
+		assert.Nil(t, err)
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	assert.Nil(t, call(oconf.TLSConf{
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		ServerName: "server.local",
+	}))
+	assert.Equal(t, "client.local", identity.CommonName)
+	assert.Equal(t, []string{"client.local"}, identity.DNSNames)
+
+	// no client certificate
+	assert.NotNil(t, call(oconf.TLSConf{
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		ServerName: "server.local",
+	}))
+	// no server name, the ip of the address isn't covered by the certificate
+	assert.NotNil(t, call(oconf.TLSConf{
+		CertFile: clientCert,
+		KeyFile:  clientKey,
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}))
+	// wrong server name
+	assert.NotNil(t, call(oconf.TLSConf{
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		ServerName: "other.local",
+	}))
+}
+
+func TestVerifyServerName(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"server.local"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	assert.Nil(t, verifyServerName(cert, "server.local"))
+	assert.Nil(t, verifyServerName(cert, "10.0.0.1"))
+	assert.NotNil(t, verifyServerName(cert, "other.local"))
+	assert.NotNil(t, verifyServerName(cert, ""))
+	err := verifyServerName(cert, "10.0.0.2")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "server_name")
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.issue(t, "server.local", 2)
+	r, err := newCertReloader(oconf.TLSConf{CertFile: certFile, KeyFile: keyFile})
+	assert.Nil(t, err)
+	before, _ := r.current()
+
+	ca.issue(t, "server.local", 3)
+	future := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, future, future))
+	r.lastCheck = time.Time{}
+	after, _ := r.current()
+
+	assert.NotEqual(t, before.Certificate[0], after.Certificate[0])
+}
@@ -0,0 +1,198 @@
+package discov
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+const (
+	filePollInterval = time.Second
+	lockFileSuffix   = ".lock"
+)
+
+// FileRegistry keeps the endpoints in a json file like {"key": ["ip:port"]},
+// the processes on one host share the file, and watchers poll it for changes.
+type FileRegistry struct {
+	path string
+}
+
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("discov: file registry requires a path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileRegistry{
+		path: path,
+	}, nil
+}
+
+func (r *FileRegistry) Register(key, endpoint string) error {
+	return r.update(func(entries map[string][]string) bool {
+		for _, val := range entries[key] {
+			if val == endpoint {
+				return false
+			}
+		}
+
+		entries[key] = append(entries[key], endpoint)
+		sort.Strings(entries[key])
+		return true
+	})
+}
+
+func (r *FileRegistry) Deregister(key, endpoint string) error {
+	return r.update(func(entries map[string][]string) bool {
+		var (
+			endpoints []string
+			changed   bool
+		)
+		for _, val := range entries[key] {
+			if val == endpoint {
+				changed = true
+			} else {
+				endpoints = append(endpoints, val)
+			}
+		}
+		if len(endpoints) > 0 {
+			entries[key] = endpoints
+		} else {
+			delete(entries, key)
+		}
+
+		return changed
+	})
+}
+
+func (r *FileRegistry) Endpoints(key string) ([]string, error) {
+	var endpoints []string
+	err := r.withLock(syscall.LOCK_SH, func() error {
+		entries, err := r.load()
+		if err != nil {
+			return err
+		}
+
+		endpoints = entries[key]
+		return nil
+	})
+
+	return endpoints, err
+}
+
+func (r *FileRegistry) Watch(key string, listener UpdateListener) (func(), error) {
+	endpoints, err := r.Endpoints(key)
+	if err != nil {
+		return nil, err
+	}
+	listener(endpoints)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(filePollInterval)
+		defer ticker.Stop()
+
+		last := endpoints
+		for {
+			select {
+			case <-ticker.C:
+				current, err := r.Endpoints(key)
+				if err != nil {
+					oc.LogErrorc("discov", err, fmt.Sprintf("fail to read registry file %s", r.path))
+					continue
+				}
+				if !sameEndpoints(last, current) {
+					last = current
+					listener(current)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}, nil
+}
+
+func (r *FileRegistry) update(fn func(entries map[string][]string) bool) error {
+	return r.withLock(syscall.LOCK_EX, func() error {
+		entries, err := r.load()
+		if err != nil {
+			return err
+		}
+		if !fn(entries) {
+			return nil
+		}
+
+		content, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+
+		// write to a temp file and rename, so that the readers never see a partial file
+		tmp := r.path + ".tmp"
+		if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, r.path)
+	})
+}
+
+func (r *FileRegistry) load() (map[string][]string, error) {
+	entries := make(map[string][]string)
+	content, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return entries, nil
+	}
+
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("discov: malformed registry file %s, error: %s", r.path, err.Error())
+	}
+
+	return entries, nil
+}
+
+func (r *FileRegistry) withLock(how int, fn func() error) error {
+	lockFile, err := os.OpenFile(r.path+lockFileSuffix, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	if err := syscall.Flock(int(lockFile.Fd()), how); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
+
+func sameEndpoints(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
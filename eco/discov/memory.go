@@ -0,0 +1,116 @@
+package discov
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryRegistry keeps the endpoints in process, it's useful for tests and for services
+// that talk to each other in one binary.
+type MemoryRegistry struct {
+	lock      sync.Mutex
+	endpoints map[string]map[string]struct{}
+	listeners map[string]map[int]UpdateListener
+	nextId    int
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		endpoints: make(map[string]map[string]struct{}),
+		listeners: make(map[string]map[int]UpdateListener),
+	}
+}
+
+func (r *MemoryRegistry) Register(key, endpoint string) error {
+	r.lock.Lock()
+	endpoints, ok := r.endpoints[key]
+	if !ok {
+		endpoints = make(map[string]struct{})
+		r.endpoints[key] = endpoints
+	}
+	if _, ok := endpoints[endpoint]; ok {
+		r.lock.Unlock()
+		return nil
+	}
+	endpoints[endpoint] = struct{}{}
+	r.lock.Unlock()
+
+	r.notify(key)
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(key, endpoint string) error {
+	r.lock.Lock()
+	endpoints, ok := r.endpoints[key]
+	if !ok {
+		r.lock.Unlock()
+		return nil
+	}
+	if _, ok := endpoints[endpoint]; !ok {
+		r.lock.Unlock()
+		return nil
+	}
+	delete(endpoints, endpoint)
+	if len(endpoints) == 0 {
+		delete(r.endpoints, key)
+	}
+	r.lock.Unlock()
+
+	r.notify(key)
+	return nil
+}
+
+func (r *MemoryRegistry) Endpoints(key string) ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.endpointsLocked(key), nil
+}
+
+func (r *MemoryRegistry) Watch(key string, listener UpdateListener) (func(), error) {
+	r.lock.Lock()
+	id := r.nextId
+	r.nextId++
+	listeners, ok := r.listeners[key]
+	if !ok {
+		listeners = make(map[int]UpdateListener)
+		r.listeners[key] = listeners
+	}
+	listeners[id] = listener
+	endpoints := r.endpointsLocked(key)
+	r.lock.Unlock()
+
+	listener(endpoints)
+
+	return func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		delete(r.listeners[key], id)
+		if len(r.listeners[key]) == 0 {
+			delete(r.listeners, key)
+		}
+	}, nil
+}
+
+func (r *MemoryRegistry) endpointsLocked(key string) []string {
+	var endpoints []string
+	for endpoint := range r.endpoints[key] {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	return endpoints
+}
+
+func (r *MemoryRegistry) notify(key string) {
+	r.lock.Lock()
+	endpoints := r.endpointsLocked(key)
+	var listeners []UpdateListener
+	for _, listener := range r.listeners[key] {
+		listeners = append(listeners, listener)
+	}
+	r.lock.Unlock()
+
+	for _, listener := range listeners {
+		listener(endpoints)
+	}
+}
@@ -0,0 +1,80 @@
+package discov
+
+import (
+	"fmt"
+	"sync"
+
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+)
+
+const (
+	TypeFile   = "file"
+	TypeMemory = "memory"
+)
+
+type (
+	// UpdateListener is called with the full list of endpoints each time the key changes.
+	UpdateListener func(endpoints []string)
+
+	// Registry keeps the endpoints of the services, keyed by the service name.
+	Registry interface {
+		// Register adds endpoint under key.
+		Register(key, endpoint string) error
+		// Deregister removes endpoint from key.
+		Deregister(key, endpoint string) error
+		// Endpoints returns the current endpoints under key.
+		Endpoints(key string) ([]string, error)
+		// Watch calls listener with the current endpoints and then on every change of key,
+		// until the returned stop func is called.
+		Watch(key string, listener UpdateListener) (stop func(), err error)
+	}
+)
+
+var (
+	registry     Registry = NewMemoryRegistry()
+	registryLock sync.RWMutex
+)
+
+// GetRegistry returns the registry used by the discov resolver.
+func GetRegistry() Registry {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return registry
+}
+
+// SetRegistry replaces the registry used by the discov resolver, it's the way to plug in other implementations.
+func SetRegistry(r Registry) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = r
+}
+
+// NewRegistry creates the registry described by c.
+func NewRegistry(c oconf.DiscovConf) (Registry, error) {
+	switch c.Type {
+	case TypeFile:
+		return NewFileRegistry(c.Path)
+	case TypeMemory:
+		return NewMemoryRegistry(), nil
+	default:
+		return nil, fmt.Errorf("discov: unknown registry type %q", c.Type)
+	}
+}
+
+// SetupRegistry creates the registry described by c and makes it the one used by the discov resolver.
+// The memory registry is shared in process, so the one already set is kept.
+func SetupRegistry(c oconf.DiscovConf) (Registry, error) {
+	if c.Type == TypeMemory {
+		if r, ok := GetRegistry().(*MemoryRegistry); ok {
+			return r, nil
+		}
+	}
+
+	r, err := NewRegistry(c)
+	if err != nil {
+		return nil, err
+	}
+
+	SetRegistry(r)
+	return r, nil
+}
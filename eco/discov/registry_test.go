@@ -0,0 +1,78 @@
+package discov
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	var (
+		r       = NewMemoryRegistry()
+		updates [][]string
+	)
+	stop, err := r.Watch("user", func(endpoints []string) {
+		updates = append(updates, endpoints)
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, r.Register("user", "10.0.0.2:10010"))
+	assert.Nil(t, r.Register("user", "10.0.0.1:10010"))
+	assert.Nil(t, r.Register("user", "10.0.0.1:10010"))
+	assert.Nil(t, r.Register("order", "10.0.0.3:10010"))
+	assert.Nil(t, r.Deregister("user", "10.0.0.2:10010"))
+	stop()
+	assert.Nil(t, r.Deregister("user", "10.0.0.1:10010"))
+
+	assert.Equal(t, [][]string{
+		nil,
+		{"10.0.0.2:10010"},
+		{"10.0.0.1:10010", "10.0.0.2:10010"},
+		{"10.0.0.1:10010"},
+	}, updates)
+
+	endpoints, err := r.Endpoints("order")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.3:10010"}, endpoints)
+}
+
+func TestFileRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discov")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	r, err := NewRegistry(oconf.DiscovConf{
+		Type: TypeFile,
+		Path: filepath.Join(dir, "registry.json"),
+	})
+	assert.Nil(t, err)
+
+	endpoints, err := r.Endpoints("user")
+	assert.Nil(t, err)
+	assert.Empty(t, endpoints)
+
+	assert.Nil(t, r.Register("user", "10.0.0.2:10010"))
+	assert.Nil(t, r.Register("user", "10.0.0.1:10010"))
+	assert.Nil(t, r.Register("user", "10.0.0.1:10010"))
+	endpoints, err = r.Endpoints("user")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1:10010", "10.0.0.2:10010"}, endpoints)
+
+	assert.Nil(t, r.Deregister("user", "10.0.0.1:10010"))
+	assert.Nil(t, r.Deregister("user", "10.0.0.2:10010"))
+	endpoints, err = r.Endpoints("user")
+	assert.Nil(t, err)
+	assert.Empty(t, endpoints)
+}
+
+func TestNewRegistry(t *testing.T) {
+	_, err := NewRegistry(oconf.DiscovConf{Type: "etcd"})
+	assert.NotNil(t, err)
+
+	_, err = NewRegistry(oconf.DiscovConf{Type: TypeFile})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,8 @@
+// Command errdoc documents the built-in Errs of onerpc, see package errdoc for the ones of the services.
+package main
+
+import "github.com/wednesdaysunny/onerpc/eco/errdoc"
+
+func main() {
+	errdoc.Main()
+}
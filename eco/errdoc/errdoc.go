@@ -0,0 +1,167 @@
+// Package errdoc documents the registered Errs in markdown or json, for the clients of the services.
+//
+// The Errs are registered by the packages defining them, so a service documents its own Errs by a tiny
+// command importing them, like
+//
+//	//go:generate go run ./errdoc -format markdown -o ERRORS.md
+//
+//	package main
+//
+//	import (
+//		"github.com/wednesdaysunny/onerpc/eco/errdoc"
+//		_ "example.com/user/errs"
+//	)
+//
+//	func main() {
+//		errdoc.Main()
+//	}
+package errdoc
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatJson     = "json"
+)
+
+var ErrUnknownFormat = errors.New("errdoc: unknown format")
+
+type (
+	// Domain is a registered ErrDomain with its Errs.
+	Domain struct {
+		Name   string        `json:"name"`
+		Min    int           `json:"min"`
+		Max    int           `json:"max"`
+		Errors []oc.ErrEntry `json:"errors"`
+	}
+)
+
+// Domains returns the registered domains with their Errs, see oc.RegisteredErrs.
+func Domains() []Domain {
+	entries := oc.RegisteredErrs()
+	var list []Domain
+	for _, d := range oc.ErrDomains() {
+		domain := Domain{
+			Name:   d.Name,
+			Min:    d.Min,
+			Max:    d.Max,
+			Errors: []oc.ErrEntry{},
+		}
+		for _, entry := range entries {
+			if entry.Domain == d.Name {
+				domain.Errors = append(domain.Errors, entry)
+			}
+		}
+		list = append(list, domain)
+	}
+
+	return list
+}
+
+// Write writes the domains in format, markdown or json.
+func Write(w io.Writer, format string, domains []Domain) error {
+	switch format {
+	case FormatMarkdown:
+		return writeMarkdown(w, domains)
+	case FormatJson:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(domains)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// Main writes the registered domains by the flags, -format and -o, and the error messages
+// to localize, -messages, see oc.LoadMessages.
+func Main() {
+	var (
+		format   = flag.String("format", FormatMarkdown, "the output format, markdown or json")
+		output   = flag.String("o", "", "the output file, stdout if empty")
+		messages = flag.String("messages", "", "the yaml or json file of the error messages by language, domain and code")
+	)
+	flag.Parse()
+
+	if err := run(*format, *output, *messages); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(format, output, messages string) error {
+	if len(messages) > 0 {
+		if err := oc.LoadMessages(messages); err != nil {
+			return err
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if len(output) > 0 {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return Write(w, format, Domains())
+}
+
+func writeMarkdown(w io.Writer, domains []Domain) error {
+	var b strings.Builder
+	b.WriteString("# Errors\n")
+	for _, d := range domains {
+		languages := languagesOf(d.Errors)
+		fmt.Fprintf(&b, "\n## %s\n\nCodes in [%d, %d].\n\n", d.Name, d.Min, d.Max)
+		b.WriteString("| Code | gRPC code | Message |")
+		for _, language := range languages {
+			fmt.Fprintf(&b, " %s |", language)
+		}
+		b.WriteString("\n| --- | --- | --- |")
+		b.WriteString(strings.Repeat(" --- |", len(languages)))
+		b.WriteString("\n")
+		for _, e := range d.Errors {
+			fmt.Fprintf(&b, "| %d | %s | %s |", e.Code, e.GrpcCode, escapeCell(e.Message))
+			for _, language := range languages {
+				fmt.Fprintf(&b, " %s |", escapeCell(e.Messages[language]))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func languagesOf(entries []oc.ErrEntry) []string {
+	set := make(map[string]struct{})
+	for _, e := range entries {
+		for language := range e.Messages {
+			set[language] = struct{}{}
+		}
+	}
+
+	languages := make([]string, 0, len(set))
+	for language := range set {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,118 @@
+package errdoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+var (
+	testDomain  = oc.RegisterDomain("errdoc.test", 60000, 60099)
+	errTestFoo  = testDomain.NewErr(60000, "foo | bar")
+	errTestBusy = testDomain.NewErr(60001, "busy")
+
+	// the same range and codes in another domain
+	otherDomain = oc.RegisterDomain("errdoc.other", 60000, 60099)
+	errOther    = otherDomain.NewErr(60000, "other")
+)
+
+func TestErrDomains(t *testing.T) {
+	assert.Panics(t, func() {
+		oc.RegisterDomain("errdoc.test", 1, 2)
+	})
+	assert.Panics(t, func() {
+		oc.RegisterDomain("errdoc.invalid", 2, 1)
+	})
+	assert.Panics(t, func() {
+		testDomain.NewErr(60000, "duplicated")
+	})
+	assert.Panics(t, func() {
+		testDomain.NewErr(60100, "out of range")
+	})
+
+	assert.Equal(t, "errdoc.other", errOther.Domain())
+	assert.False(t, errors.Is(errOther, errTestFoo))
+	assert.True(t, errors.Is(oc.ErrFromGoErr(errOther.Status().Err()), errOther))
+	assert.False(t, errors.Is(oc.ErrFromGoErr(errOther.Status().Err()), errTestFoo))
+	// the domain is unknown from the message
+	assert.True(t, errors.Is(oc.ErrFromString(errOther.Error()), errTestFoo))
+	assert.Equal(t, []*oc.Err{errTestFoo, errTestBusy}, testDomain.Errs())
+	assert.Equal(t, []*oc.Err{errOther}, otherDomain.Errs())
+}
+
+func TestWrite(t *testing.T) {
+	oc.SetMessages(oc.Messages{"en": {"errdoc.test": {60001: "Busy"}, "errdoc.other": {60000: "Other"}}})
+	defer oc.SetMessages(nil)
+
+	var domain Domain
+	for _, d := range Domains() {
+		if d.Name == testDomain.Name {
+			domain = d
+		}
+	}
+	assert.Equal(t, Domain{
+		Name: "errdoc.test",
+		Min:  60000,
+		Max:  60099,
+		Errors: []oc.ErrEntry{
+			{Domain: "errdoc.test", Code: 60000, GrpcCode: "Unknown", Message: "foo | bar"},
+			{Domain: "errdoc.test", Code: 60001, GrpcCode: "Unknown", Message: "busy", Messages: map[string]string{"en": "Busy"}},
+		},
+	}, domain)
+
+	var buf bytes.Buffer
+	assert.Nil(t, Write(&buf, FormatMarkdown, []Domain{domain}))
+	assert.Equal(t, `# Errors
+
+## errdoc.test
+
+Codes in [60000, 60099].
+
+| Code | gRPC code | Message | en |
+| --- | --- | --- | --- |
+| 60000 | Unknown | foo \| bar |  |
+| 60001 | Unknown | busy | Busy |
+`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, Write(&buf, FormatJson, []Domain{domain}))
+	var decoded []Domain
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, []Domain{domain}, decoded)
+
+	assert.Equal(t, ErrUnknownFormat, Write(&buf, "xml", nil))
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errdoc")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "errors.json")
+	assert.Nil(t, run(FormatJson, output, ""))
+	data, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	var domains []Domain
+	assert.Nil(t, json.Unmarshal(data, &domains))
+	for _, d := range domains {
+		if d.Name != oc.ErrorDomain {
+			continue
+		}
+		assert.Equal(t, len(oc.AllErrors), len(d.Errors))
+		assert.Contains(t, d.Errors, oc.ErrEntry{
+			Domain:   oc.ErrorDomain,
+			Code:     oc.ErrNotFound.Code,
+			GrpcCode: "NotFound",
+			Message:  oc.ErrNotFound.Message,
+		})
+		return
+	}
+	t.Error("no default domain")
+}
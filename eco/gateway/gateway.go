@@ -0,0 +1,452 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	occ "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"github.com/wednesdaysunny/onerpc/eco/inter/toolkit/jsonpb"
+	onet "github.com/wednesdaysunny/onerpc/eco/inter/toolkit/net"
+	"github.com/wednesdaysunny/onerpc/eco/load"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	defaultMaxBytes = 8 << 20
+	contentTypeJson = "application/json; charset=utf-8"
+)
+
+// the headers about the http connection itself, never forwarded as metadata
+var skippedHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"te":                true,
+	"trailer":           true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+	"content-length":    true,
+	"content-type":      true,
+	"accept-encoding":   true,
+}
+
+// the metadata set by the gateway or the trusted callers, never taken from the http headers,
+// like the client ip, the user and the platform of the app, and the tracing ones
+var reservedHeaders = func() map[string]bool {
+	reserved := make(map[string]bool)
+	for _, key := range []string{
+		occ.Md_CLIENTIP, occ.Md_Host, occ.Md_Uri, occ.Md_Method, occ.Md_Path, occ.Md_Route,
+		occ.Md_RequestId, occ.Md_USERID, occ.Md_APPHEADER, occ.Md_Version, occ.Md_DEVICEID,
+		occ.Md_DEVICETYPE, occ.Md_Bundle_Id, occ.Md_App_Type, occ.Md_Client_Type,
+	} {
+		reserved[key] = true
+	}
+	for _, key := range occ.TraceHeaders {
+		reserved[key] = true
+	}
+
+	return reserved
+}()
+
+// Gateway serves the unary grpc methods as http/json, on POST /{package.Service}/{Method}
+// and the paths of the google.api.http annotations. The headers but the reserved ones are forwarded as metadata,
+// and the Errs are returned with the http status of their codes, like 404 for 40400.
+type Gateway struct {
+	conf        oconf.RestConf
+	conn        grpc.ClientConnInterface
+	routes      []*route
+	marshaler   *jsonpb.Marshaler
+	unmarshaler *jsonpb.Unmarshaler
+	shedder     *load.Shedder
+	trusted     []*net.IPNet
+	conns       chan struct{}
+	server      *http.Server
+}
+
+// NewGateway creates a gateway calling the grpc methods through conn.
+func NewGateway(c oconf.RestConf, conn grpc.ClientConnInterface) (*Gateway, error) {
+	trusted, err := onet.ParseCIDRs(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Gateway{
+		conf:    c,
+		conn:    conn,
+		trusted: trusted,
+		marshaler: &jsonpb.Marshaler{
+			OrigName:     c.OrigName,
+			EmitDefaults: c.EmitDefaults,
+		},
+		unmarshaler: &jsonpb.Unmarshaler{
+			// the old clients may send the removed fields
+			AllowUnknownFields: true,
+		},
+	}
+	if c.CpuThreshold > 0 {
+		g.shedder = load.NewShedder(c.CpuThreshold)
+	}
+	if c.MaxConns > 0 {
+		g.conns = make(chan struct{}, c.MaxConns)
+	}
+	if g.conf.MaxBytes <= 0 {
+		g.conf.MaxBytes = defaultMaxBytes
+	}
+	g.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Handler: g,
+	}
+
+	return g, nil
+}
+
+// Register adds the routes of the unary methods of services, like the ones of grpc.Server.GetServiceInfo.
+// The services missing in the protobuf registry are skipped. Call it before Start.
+func (g *Gateway) Register(services map[string]grpc.ServiceInfo) error {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			oc.LogWarnc("gateway", err, fmt.Sprintf("skip service %s", name))
+			continue
+		}
+		service, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+
+		for _, info := range services[name].Methods {
+			if info.IsClientStream || info.IsServerStream {
+				continue
+			}
+			method := service.Methods().ByName(protoreflect.Name(info.Name))
+			if method == nil {
+				continue
+			}
+			routes, err := buildRoutes(service, method)
+			if err != nil {
+				return err
+			}
+			g.routes = append(g.routes, routes...)
+		}
+	}
+
+	return nil
+}
+
+// Start serves the http requests, it blocks until the gateway stops.
+func (g *Gateway) Start() error {
+	if err := g.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// Stop stops the gateway, the in-flight requests are waited until ctx is done.
+func (g *Gateway) Stop(ctx context.Context) error {
+	return g.server.Shutdown(ctx)
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.conns != nil {
+		select {
+		case g.conns <- struct{}{}:
+			defer func() {
+				<-g.conns
+			}()
+		default:
+			writeError(w, http.StatusServiceUnavailable, oc.ErrServiceUnavailable)
+			return
+		}
+	}
+	var promise load.Promise
+	if g.shedder != nil {
+		var err error
+		if promise, err = g.shedder.Allow(); err != nil {
+			writeError(w, http.StatusServiceUnavailable, oc.ErrServerTooBusy)
+			return
+		}
+	}
+
+	start := time.Now()
+	code := g.handle(w, r)
+	if promise != nil {
+		// the timed out calls are the sign of overloading, their latencies are meaningless
+		if code == http.StatusGatewayTimeout {
+			promise.Fail()
+		} else {
+			promise.Pass()
+		}
+	}
+	if g.conf.Verbose {
+		l := time.Since(start)
+		oc.LogUserActivity(oc.LogFields{
+			"type":          "gatewayaccess",
+			"method":        r.Method,
+			"uri":           r.RequestURI,
+			"status":        code,
+			"remote_ip":     clientIp(r, g.trusted),
+			"latency":       l.Nanoseconds() / 1000000,
+			"latency_human": l.String(),
+		}, "gatewayaccess")
+	}
+}
+
+// handle serves the request and returns the http status.
+func (g *Gateway) handle(w http.ResponseWriter, r *http.Request) int {
+	rt, params := g.match(r)
+	if rt == nil {
+		return writeError(w, http.StatusNotFound, oc.ErrNotFound)
+	}
+
+	in := rt.input.New()
+	if e := g.bind(w, r, rt, params, in); e != nil {
+		return writeError(w, http.StatusBadRequest, e)
+	}
+
+	ctx := metadata.NewOutgoingContext(r.Context(), outgoingMetadata(r, g.trusted))
+	if g.conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(g.conf.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	out := rt.output.New()
+	if err := g.conn.Invoke(ctx, rt.fullMethod, protoimpl.X.ProtoMessageV1Of(in.Interface()),
+		protoimpl.X.ProtoMessageV1Of(out.Interface())); err != nil {
+		code, e := HttpError(err)
+		return writeError(w, code, e)
+	}
+
+	if len(rt.responseBody) > 0 {
+		m, fd, err := mutableField(out, rt.responseBody)
+		if err != nil {
+			return writeError(w, http.StatusInternalServerError, oc.ErrInternal)
+		}
+		out = m.Get(fd).Message()
+	}
+
+	var buf bytes.Buffer
+	if err := g.marshaler.Marshal(&buf, protoimpl.X.ProtoMessageV1Of(out.Interface())); err != nil {
+		oc.LogErrorc("gateway", err, fmt.Sprintf("fail to marshal the response of %s", rt.fullMethod))
+		return writeError(w, http.StatusInternalServerError, oc.ErrInternal)
+	}
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+
+	return http.StatusOK
+}
+
+func (g *Gateway) match(r *http.Request) (*route, map[string]string) {
+	for _, rt := range g.routes {
+		if rt.verb != r.Method {
+			continue
+		}
+		if params, ok := rt.template.match(r.URL.Path); ok {
+			return rt, params
+		}
+	}
+
+	return nil, nil
+}
+
+// bind fills in with the body, the path variables and the query parameters.
+func (g *Gateway) bind(w http.ResponseWriter, r *http.Request, rt *route, params map[string]string,
+	in protoreflect.Message) *oc.Err {
+	switch rt.body {
+	case "":
+	case bodyAll:
+		if err := g.decodeBody(w, r, in); err != nil {
+			return oc.ErrIllegalJson
+		}
+	default:
+		m, fd, err := mutableField(in, rt.body)
+		if err != nil {
+			return oc.ErrParams
+		}
+		if err := g.decodeBody(w, r, m.Mutable(fd).Message()); err != nil {
+			return oc.ErrIllegalJson
+		}
+	}
+
+	for field, value := range params {
+		if err := setField(in, field, []string{value}, g.parseMessage); err != nil {
+			return oc.ErrParams
+		}
+	}
+
+	// the query parameters fill the fields not bound yet
+	if rt.body == bodyAll {
+		return nil
+	}
+	for key, values := range r.URL.Query() {
+		if _, ok := params[key]; ok {
+			continue
+		}
+		if len(rt.body) > 0 && (key == rt.body || strings.HasPrefix(key, rt.body+".")) {
+			continue
+		}
+		if err := setField(in, key, values, g.parseMessage); err != nil {
+			return oc.ErrParams
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) decodeBody(w http.ResponseWriter, r *http.Request, m protoreflect.Message) error {
+	err := g.unmarshaler.Unmarshal(http.MaxBytesReader(w, r.Body, g.conf.MaxBytes),
+		protoimpl.X.ProtoMessageV1Of(m.Interface()))
+	// an empty body means an empty message
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
+
+// parseMessage parses the json value of a message field, the strings can be unquoted in paths and queries,
+// like the timestamps and the wrappers.
+func (g *Gateway) parseMessage(s string, m protoreflect.Message) error {
+	msg := protoimpl.X.ProtoMessageV1Of(m.Interface())
+	if err := g.unmarshaler.Unmarshal(strings.NewReader(s), msg); err == nil {
+		return nil
+	}
+
+	return g.unmarshaler.Unmarshal(strings.NewReader(strconv.Quote(s)), msg)
+}
+
+// HttpError returns the http status and the Err of the error of a grpc call. The errors with a grpc code
+// set, like InvalidArgument of the validation, and the ones not Errs are mapped by their grpc codes.
+// Otherwise, the status of an Err is the first three digits of its code, the ones not an http status are 500.
+func HttpError(err error) (int, *oc.Err) {
+	e := oc.ErrFromGoErr(err)
+	if code := status.Code(err); code != codes.Unknown || e.Code == oc.ErrInternalFromString.Code {
+		return httpStatusFromCode(code), e
+	}
+
+	if code := e.Code / 100; code >= 100 && code < 600 {
+		return code, e
+	}
+
+	return http.StatusInternalServerError, e
+}
+
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		// the client closed the request, as nginx does
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, e *oc.Err) int {
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(code)
+	io.WriteString(w, e.Error())
+
+	return code
+}
+
+// outgoingMetadata forwards the headers but the reserved ones, and sets the metadata of the request,
+// like the client ip.
+func outgoingMetadata(r *http.Request, trusted []*net.IPNet) metadata.MD {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		key = strings.ToLower(key)
+		if skippedHeaders[key] || reservedHeaders[key] || strings.HasPrefix(key, "grpc-") {
+			continue
+		}
+		md[key] = append(md[key], values...)
+	}
+
+	md.Set(occ.Md_CLIENTIP, clientIp(r, trusted))
+	md.Set(occ.Md_Host, r.Host)
+	md.Set(occ.Md_Uri, r.RequestURI)
+	md.Set(occ.Md_Method, r.Method)
+	md.Set(occ.Md_Path, r.URL.Path)
+	md.Set(occ.Md_UserAgent, r.UserAgent())
+
+	return md
+}
+
+// clientIp returns the ip of the client, the peer itself unless it's a trusted proxy, since the clients
+// may send any X-Forwarded-For. Behind the trusted proxies, it's the right-most untrusted hop.
+func clientIp(r *http.Request, trusted []*net.IPNet) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if ip := net.ParseIP(peer); ip == nil || !onet.IsIPWithin(ip, trusted) {
+		return peer
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); ip != nil {
+			return ip.String()
+		}
+		return peer
+	}
+
+	// each proxy appends its peer, so the hops are trusted from the right
+	client := peer
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !onet.IsIPWithin(ip, trusted) {
+			break
+		}
+	}
+
+	return client
+}
@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	occ "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	onet "github.com/wednesdaysunny/onerpc/eco/inter/toolkit/net"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		ok       bool
+		params   map[string]string
+	}{
+		{template: "/v1/users/{id}", path: "/v1/users/42", ok: true, params: map[string]string{"id": "42"}},
+		{template: "/v1/users/{id}", path: "/v1/users/42/books", ok: false},
+		{template: "/v1/users/{id}", path: "/v1/users/", ok: false},
+		{template: "/v1/{name=shelves/*}/books", path: "/v1/shelves/1/books", ok: true,
+			params: map[string]string{"name": "shelves/1"}},
+		{template: "/v1/{name=files/**}", path: "/v1/files/a/b/c", ok: true, params: map[string]string{"name": "files/a/b/c"}},
+		{template: "/v1/users/{id}:ban", path: "/v1/users/42:ban", ok: true, params: map[string]string{"id": "42"}},
+		{template: "/v1/users/{id}:ban", path: "/v1/users/42", ok: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template+" "+test.path, func(t *testing.T) {
+			tpl, err := parseTemplate(test.template)
+			assert.Nil(t, err)
+			params, ok := tpl.match(test.path)
+			assert.Equal(t, test.ok, ok)
+			if ok {
+				assert.Equal(t, test.params, params)
+			}
+		})
+	}
+
+	for _, bad := range []string{"v1/users", "/v1/{id", "/v1/**/users", "/v1//users"} {
+		_, err := parseTemplate(bad)
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestHttpError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+		errc int
+	}{
+		{err: status.Error(codes.ResourceExhausted, oc.ErrTooManyRequests.Error()), code: 429, errc: oc.ErrTooManyRequests.Code},
+		{err: status.Error(codes.Unknown, oc.ErrNotFound.Error()), code: 404, errc: oc.ErrNotFound.Code},
+		{err: status.Error(codes.Unknown, oc.ErrParams.Error()), code: 500, errc: oc.ErrParams.Code},
+		{err: status.Error(codes.InvalidArgument, oc.ErrParams.Error()), code: 400, errc: oc.ErrParams.Code},
+		{err: oc.ErrNotFound, code: 404, errc: oc.ErrNotFound.Code},
+		{err: status.Error(codes.Unavailable, "connection refused"), code: 503, errc: oc.ErrInternalFromString.Code},
+		{err: status.Error(codes.DeadlineExceeded, "context deadline exceeded"), code: 504, errc: oc.ErrInternalFromString.Code},
+	}
+
+	for _, test := range tests {
+		code, e := HttpError(test.err)
+		assert.Equal(t, test.code, code)
+		assert.Equal(t, test.errc, e.Code)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	var app string
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		app = strings.Join(md.Get("x-app"), ",")
+		return handler(ctx, req)
+	}))
+	hs := health.NewServer()
+	hs.SetServingStatus("down", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, hs)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	gw, err := NewGateway(oconf.RestConf{OrigName: true}, conn)
+	assert.Nil(t, err)
+	assert.Nil(t, gw.Register(server.GetServiceInfo()))
+	input, output := gw.routes[0].input, gw.routes[0].output
+	rt, err := newRoute(&annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Get{Get: "/v1/health/{service}"},
+	}, "/grpc.health.v1.Health/Check", input, output)
+	assert.Nil(t, err)
+	gw.routes = append(gw.routes, rt)
+
+	httpServer := httptest.NewServer(gw)
+	defer httpServer.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+		resp   string
+	}{
+		{name: "default route", method: http.MethodPost, path: "/grpc.health.v1.Health/Check", body: `{"service":""}`,
+			code: http.StatusOK, resp: `{"status":"SERVING"}`},
+		{name: "empty body", method: http.MethodPost, path: "/grpc.health.v1.Health/Check",
+			code: http.StatusOK, resp: `{"status":"SERVING"}`},
+		{name: "annotated route", method: http.MethodGet, path: "/v1/health/down",
+			code: http.StatusOK, resp: `{"status":"NOT_SERVING"}`},
+		{name: "grpc error", method: http.MethodGet, path: "/v1/health/unknown", code: http.StatusNotFound},
+		{name: "illegal json", method: http.MethodPost, path: "/grpc.health.v1.Health/Check", body: `{"service":`,
+			code: http.StatusBadRequest, resp: oc.ErrIllegalJson.Error()},
+		{name: "no route", method: http.MethodGet, path: "/grpc.health.v1.Health/Check",
+			code: http.StatusNotFound, resp: oc.ErrNotFound.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, httpServer.URL+test.path, strings.NewReader(test.body))
+			assert.Nil(t, err)
+			req.Header.Set("X-App", "web")
+			resp, err := http.DefaultClient.Do(req)
+			assert.Nil(t, err)
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, test.code, resp.StatusCode)
+			if len(test.resp) > 0 {
+				assert.Equal(t, test.resp, string(body))
+			}
+		})
+	}
+	assert.Equal(t, "web", app)
+}
+
+func TestClientIp(t *testing.T) {
+	trusted, err := onet.ParseCIDRs([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIp    string
+		ip        string
+	}{
+		{name: "direct", remote: "1.2.3.4:5678", ip: "1.2.3.4"},
+		{name: "untrusted peer", remote: "1.2.3.4:5678", forwarded: []string{"5.6.7.8"}, realIp: "5.6.7.8", ip: "1.2.3.4"},
+		{name: "trusted peer", remote: "10.0.0.1:5678", forwarded: []string{"5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "spoofed hops", remote: "10.0.0.1:5678", forwarded: []string{"9.9.9.9, 5.6.7.8, 10.0.0.2"},
+			ip: "5.6.7.8"},
+		{name: "multiple headers", remote: "10.0.0.1:5678", forwarded: []string{"9.9.9.9", "5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "all trusted", remote: "10.0.0.1:5678", forwarded: []string{"10.0.0.3, 10.0.0.2"}, ip: "10.0.0.3"},
+		{name: "illegal hop", remote: "10.0.0.1:5678", forwarded: []string{"5.6.7.8, unknown"}, ip: "10.0.0.1"},
+		{name: "real ip", remote: "10.0.0.1:5678", realIp: "5.6.7.8", ip: "5.6.7.8"},
+		{name: "no port", remote: "1.2.3.4", ip: "1.2.3.4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remote
+			for _, forwarded := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if len(test.realIp) > 0 {
+				r.Header.Set("X-Real-Ip", test.realIp)
+			}
+			assert.Equal(t, test.ip, clientIp(r, trusted))
+		})
+	}
+}
+
+func TestOutgoingMetadata(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.Header.Set("X-App", "web")
+	r.Header.Set("Connection", "close")
+	r.Header.Set("Grpc-Timeout", "1S")
+	r.Header.Set(occ.Md_CLIENTIP, "5.6.7.8")
+	r.Header.Set(occ.Md_USERID, "1")
+	r.Header.Set(occ.TraceHeaders[0], "trace")
+
+	md := outgoingMetadata(r, nil)
+	assert.Equal(t, []string{"web"}, md.Get("x-app"))
+	assert.Equal(t, []string{"1.2.3.4"}, md.Get(occ.Md_CLIENTIP))
+	assert.Empty(t, md.Get("connection"))
+	assert.Empty(t, md.Get("grpc-timeout"))
+	assert.Empty(t, md.Get(occ.Md_USERID))
+	assert.Empty(t, md.Get(occ.TraceHeaders[0]))
+}
@@ -0,0 +1,387 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	bodyAll  = "*"
+	anyPart  = "*"
+	anyParts = "**"
+)
+
+var ErrBadTemplate = errors.New("bad path template")
+
+type (
+	// route binds an http method and path template to a unary grpc method.
+	route struct {
+		verb         string
+		template     *pathTemplate
+		fullMethod   string
+		input        protoreflect.MessageType
+		output       protoreflect.MessageType
+		body         string
+		responseBody string
+	}
+
+	// pathTemplate is the path of google.api.http, like /v1/{name=shelves/*}/books/{id}:publish.
+	pathTemplate struct {
+		// the literals, or * for one part, or ** for the rest parts
+		segments []string
+		vars     []variable
+		verb     string
+	}
+
+	// variable binds the parts in [start, end) of the segments to field.
+	variable struct {
+		field string
+		start int
+		end   int
+	}
+)
+
+// buildRoutes builds the default route and the ones of google.api.http of the method.
+func buildRoutes(service protoreflect.ServiceDescriptor, method protoreflect.MethodDescriptor) ([]*route, error) {
+	input, err := protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName())
+	if err != nil {
+		return nil, err
+	}
+	output, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, err
+	}
+
+	fullMethod := fmt.Sprintf("/%s/%s", service.FullName(), method.Name())
+	routes := []*route{
+		{
+			verb: http.MethodPost,
+			template: &pathTemplate{
+				segments: []string{string(service.FullName()), string(method.Name())},
+			},
+			fullMethod: fullMethod,
+			input:      input,
+			output:     output,
+			body:       bodyAll,
+		},
+	}
+
+	rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return routes, nil
+	}
+
+	for _, item := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		r, err := newRoute(item, fullMethod, input, output)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fullMethod, err)
+		}
+		if r != nil {
+			routes = append(routes, r)
+		}
+	}
+
+	return routes, nil
+}
+
+func newRoute(rule *annotations.HttpRule, fullMethod string, input, output protoreflect.MessageType) (*route, error) {
+	var verb, path string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		verb, path = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		verb, path = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		verb, path = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		verb, path = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		verb, path = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		verb, path = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return nil, nil
+	}
+
+	template, err := parseTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	desc := input.Descriptor()
+	for _, v := range template.vars {
+		if _, err := findField(desc, v.field); err != nil {
+			return nil, err
+		}
+	}
+	if body := rule.GetBody(); len(body) > 0 && body != bodyAll {
+		if err := checkMessageField(desc, body); err != nil {
+			return nil, err
+		}
+	}
+	if body := rule.GetResponseBody(); len(body) > 0 {
+		if err := checkMessageField(output.Descriptor(), body); err != nil {
+			return nil, err
+		}
+	}
+
+	return &route{
+		verb:         verb,
+		template:     template,
+		fullMethod:   fullMethod,
+		input:        input,
+		output:       output,
+		body:         rule.GetBody(),
+		responseBody: rule.GetResponseBody(),
+	}, nil
+}
+
+func parseTemplate(path string) (*pathTemplate, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%w: %s", ErrBadTemplate, path)
+	}
+
+	var t pathTemplate
+	rest := path[1:]
+	if pos := strings.LastIndexByte(rest, ':'); pos >= 0 && pos > strings.LastIndexByte(rest, '}') {
+		t.verb = rest[pos+1:]
+		rest = rest[:pos]
+	}
+
+	for len(rest) > 0 {
+		if rest[0] == '{' {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrBadTemplate, path)
+			}
+			field, pattern := rest[1:end], anyPart
+			if pos := strings.IndexByte(field, '='); pos >= 0 {
+				field, pattern = field[:pos], field[pos+1:]
+			}
+			start := len(t.segments)
+			t.segments = append(t.segments, strings.Split(pattern, "/")...)
+			t.vars = append(t.vars, variable{field: field, start: start, end: len(t.segments)})
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexByte(rest, '/')
+			if end < 0 {
+				end = len(rest)
+			}
+			t.segments = append(t.segments, rest[:end])
+			rest = rest[end:]
+		}
+
+		if len(rest) > 0 {
+			if rest[0] != '/' {
+				return nil, fmt.Errorf("%w: %s", ErrBadTemplate, path)
+			}
+			rest = rest[1:]
+		}
+	}
+
+	for i, seg := range t.segments {
+		if len(seg) == 0 || (seg == anyParts && i != len(t.segments)-1) {
+			return nil, fmt.Errorf("%w: %s", ErrBadTemplate, path)
+		}
+	}
+
+	return &t, nil
+}
+
+// match matches path, and returns the values of the variables.
+func (t *pathTemplate) match(path string) (map[string]string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	if len(t.verb) > 0 {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+
+	parts := strings.Split(path, "/")
+	n := len(t.segments)
+	if n > 0 && t.segments[n-1] == anyParts {
+		if len(parts) < n {
+			return nil, false
+		}
+	} else if len(parts) != n {
+		return nil, false
+	}
+
+	values := make([]string, n)
+	for i, seg := range t.segments {
+		if seg == anyParts {
+			values[i] = strings.Join(parts[i:], "/")
+			break
+		}
+		if len(parts[i]) == 0 || (seg != anyPart && seg != parts[i]) {
+			return nil, false
+		}
+		values[i] = parts[i]
+	}
+
+	params := make(map[string]string, len(t.vars))
+	for _, v := range t.vars {
+		params[v.field] = strings.Join(values[v.start:v.end], "/")
+	}
+
+	return params, true
+}
+
+// findField finds the field by the dotted path of the proto or json names.
+func findField(desc protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := desc.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = desc.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q", path)
+		}
+		if i == len(names)-1 {
+			return fd, nil
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("field %q is not a message", path)
+		}
+		desc = fd.Message()
+	}
+
+	return nil, fmt.Errorf("unknown field %q", path)
+}
+
+func checkMessageField(desc protoreflect.MessageDescriptor, path string) error {
+	fd, err := findField(desc, path)
+	if err != nil {
+		return err
+	}
+	if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("field %q is not a message", path)
+	}
+
+	return nil
+}
+
+// mutableField returns the message holding the field of path, and the field.
+func mutableField(m protoreflect.Message, path string) (protoreflect.Message, protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd, err := findField(m.Descriptor(), name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return nil, nil, fmt.Errorf("field %q is not a message", path)
+		}
+		m = m.Mutable(fd).Message()
+	}
+
+	fd, err := findField(m.Descriptor(), names[len(names)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return m, fd, nil
+}
+
+// setField sets the field of path with the values, the message fields are set with their json values.
+func setField(m protoreflect.Message, path string, values []string, parseMessage func(string, protoreflect.Message) error) error {
+	m, fd, err := mutableField(m, path)
+	if err != nil {
+		return err
+	}
+	if fd.IsMap() {
+		return fmt.Errorf("map field %q can't be bound", path)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	parse := func(s string) (protoreflect.Value, error) {
+		if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+			var v protoreflect.Value
+			if fd.IsList() {
+				v = m.Mutable(fd).List().NewElement()
+			} else {
+				v = m.NewField(fd)
+			}
+			if err := parseMessage(s, v.Message()); err != nil {
+				return protoreflect.Value{}, err
+			}
+			return v, nil
+		}
+
+		return parseScalar(fd, s)
+	}
+
+	if fd.IsList() {
+		list := m.Mutable(fd).List()
+		for _, s := range values {
+			v, err := parse(s)
+			if err != nil {
+				return fmt.Errorf("field %q: %v", path, err)
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+
+	v, err := parse(values[len(values)-1])
+	if err != nil {
+		return fmt.Errorf("field %q: %v", path, err)
+	}
+	m.Set(fd, v)
+
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(i)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		i, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(i), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		if v := fd.Enum().Values().ByName(protoreflect.Name(s)); v != nil {
+			return protoreflect.ValueOfEnum(v.Number()), nil
+		}
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+	}
+}
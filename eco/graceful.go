@@ -70,6 +70,18 @@ func (lm *listenerManager) addListener(fn func()) (waitForCalled func()) {
 	}
 }
 
+// addFirstListener adds fn to be called before the listeners added already.
+func (lm *listenerManager) addFirstListener(fn func()) {
+	lm.waitGroup.Add(1)
+
+	lm.lock.Lock()
+	lm.listeners = append([]func(){func() {
+		defer lm.waitGroup.Done()
+		fn()
+	}}, lm.listeners...)
+	lm.lock.Unlock()
+}
+
 func (lm *listenerManager) notifyListeners() {
 	lm.lock.Lock()
 	defer lm.lock.Unlock()
@@ -0,0 +1,210 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"gopkg.in/redis.v5"
+)
+
+const (
+	serviceName   = "grpc.health.v1.Health"
+	checkInterval = time.Second * 5
+	checkTimeout  = time.Second * 3
+)
+
+var (
+	ErrNilMysql = errors.New("health: mysql not connected")
+	ErrNilRedis = errors.New("health: redis not connected")
+	ErrNotReady = errors.New("health: not serving")
+)
+
+type (
+	// Checker checks a dependency, like mysql or redis, returns nil if healthy.
+	Checker func(ctx context.Context) error
+
+	// Server is the grpc health service, the status of all the services registered is NOT_SERVING
+	// before Resume or after Shutdown, or if any of the checkers failed, and SERVING otherwise.
+	Server struct {
+		*grpchealth.Server
+		lock     sync.Mutex
+		services []string
+		checkers map[string]Checker
+		serving  bool
+		healthy  bool
+		shutdown bool
+		stop     chan struct{}
+	}
+)
+
+func NewServer() *Server {
+	s := &Server{
+		Server:   grpchealth.NewServer(),
+		checkers: make(map[string]Checker),
+		healthy:  true,
+		stop:     make(chan struct{}),
+	}
+	// the overall status is SERVING by default in grpc
+	s.Server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return s
+}
+
+// MysqlChecker checks db created by toolkit.CreateDB.
+func MysqlChecker(db *gorm.DB) Checker {
+	return func(ctx context.Context) error {
+		if db == nil || db.DB() == nil {
+			return ErrNilMysql
+		}
+
+		return db.DB().PingContext(ctx)
+	}
+}
+
+// RedisChecker checks client created by toolkit.InitRedis, which is nil if fail to connect.
+func RedisChecker(client *redis.Client) Checker {
+	return func(ctx context.Context) error {
+		if client == nil {
+			return ErrNilRedis
+		}
+
+		return client.Ping().Err()
+	}
+}
+
+// AddChecker adds the checker of the dependency with name, the checkers run every 5 seconds after Resume.
+func (s *Server) AddChecker(name string, checker Checker) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.checkers[name] = checker
+}
+
+// Register registers the health service to server, unless registered already.
+func (s *Server) Register(server *grpc.Server) {
+	if _, ok := server.GetServiceInfo()[serviceName]; ok {
+		oc.LogWarnc("health", nil, "health service already registered, the dependency checks take no effect")
+		return
+	}
+
+	healthpb.RegisterHealthServer(server, s)
+}
+
+// Resume sets the services of server to SERVING if the checkers passed, and starts checking.
+func (s *Server) Resume(server *grpc.Server) {
+	s.lock.Lock()
+	if s.shutdown || s.serving {
+		s.lock.Unlock()
+		return
+	}
+
+	s.services = []string{""}
+	for name := range server.GetServiceInfo() {
+		s.services = append(s.services, name)
+	}
+	s.serving = true
+	hasCheckers := len(s.checkers) > 0
+	s.lock.Unlock()
+
+	if hasCheckers {
+		// keep NOT_SERVING until the first check is done
+		go s.run()
+	} else {
+		s.check()
+	}
+}
+
+// Ready returns nil if the server is SERVING, for the readiness probes over http.
+func (s *Server) Ready() error {
+	resp, err := s.Server.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return ErrNotReady
+	}
+
+	return nil
+}
+
+// Shutdown sets the services to NOT_SERVING, and ignores the later updates.
+func (s *Server) Shutdown() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.shutdown {
+		return
+	}
+
+	s.shutdown = true
+	close(s.stop)
+	s.Server.Shutdown()
+}
+
+func (s *Server) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	s.check()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+func (s *Server) check() {
+	s.lock.Lock()
+	checkers := make(map[string]Checker, len(s.checkers))
+	for name, checker := range s.checkers {
+		checkers[name] = checker
+	}
+	s.lock.Unlock()
+
+	healthy := true
+	for name, checker := range checkers {
+		if err := runChecker(checker); err != nil {
+			oc.LogErrorc("health", err, fmt.Sprintf("health check %s failed", name))
+			healthy = false
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.shutdown {
+		return
+	}
+
+	if healthy != s.healthy {
+		oc.LogInfoc("health", fmt.Sprintf("health status changed, healthy: %t", healthy))
+	}
+	s.healthy = healthy
+	status := healthpb.HealthCheckResponse_SERVING
+	if !healthy {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range s.services {
+		s.Server.SetServingStatus(service, status)
+	}
+}
+
+func runChecker(checker Checker) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("health checker panic: %v", p)
+		}
+	}()
+
+	return checker(ctx)
+}
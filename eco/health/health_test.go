@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func checkStatus(t *testing.T, s *Server, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	assert.Nil(t, err)
+	return resp.Status
+}
+
+func TestServerLifecycle(t *testing.T) {
+	s := NewServer()
+	server := grpc.NewServer()
+	s.Register(server)
+	// registered twice is ignored
+	s.Register(server)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, ""))
+	assert.Equal(t, ErrNotReady, s.Ready())
+
+	s.Resume(server)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, serviceName))
+	assert.Nil(t, s.Ready())
+
+	s.Shutdown()
+	s.Shutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, ""))
+	assert.Equal(t, ErrNotReady, s.Ready())
+	s.check()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, ""))
+}
+
+func TestServerCheckers(t *testing.T) {
+	s := NewServer()
+	server := grpc.NewServer()
+	s.Register(server)
+	s.services = []string{"", serviceName}
+
+	assert.Equal(t, ErrNilRedis, RedisChecker(nil)(context.Background()))
+
+	var failure error
+	s.AddChecker("mysql", MysqlChecker(nil))
+	s.check()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, ""))
+
+	s.AddChecker("mysql", func(ctx context.Context) error {
+		return failure
+	})
+	s.AddChecker("redis", func(ctx context.Context) error {
+		panic("boom")
+	})
+	s.check()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, serviceName))
+
+	failure = errors.New("down")
+	s.AddChecker("redis", func(ctx context.Context) error {
+		return nil
+	})
+	s.check()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, ""))
+
+	failure = nil
+	s.check()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, serviceName))
+}
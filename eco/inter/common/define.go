@@ -23,4 +23,10 @@ const (
 const (
 	LanguageEn = "en"
 	LanguageZh = "zh"
+)
+
+// the metadata of the language of the callers, the app header goes before the Accept-Language
+const (
+	MdAcceptLanguage = "accept-language"
+	MdAppLanguage    = "x-app-language"
 )
\ No newline at end of file
@@ -65,13 +65,36 @@ type (
 		OutputDest string `yaml:"output_dest"`
 	}
 
-	// ConfigRpcCacheRedis sets the RPC cache backend by Redis
+	// RateLimitConf limits the calls of a method per caller, one rule per method and caller key.
+	RateLimitConf struct {
+		Method string `yaml:"method"` // the full method, like /package.service/method, * for all the methods together
+		By     string `yaml:"by"`     // the caller key, app, user or ip, default is app
+		Rate   int64  `yaml:"rate"`   // the calls allowed per period
+		Period int64  `yaml:"period"` // in seconds, default is 1
+		Burst  int64  `yaml:"burst"`  // for the local store only, default is rate
+		Store  string `yaml:"store"`  // local or redis, default is local, redis shares the limits by the redis of the server
+	}
+
+	// IPFilterConf rejects the callers by ip, the lists are CIDRs or IPs, the ones in File and
+	// RedisKey, in json like {"allow": [], "deny": []}, are reloaded on change and added to the lists.
+	IPFilterConf struct {
+		Allow          []string `yaml:"allow"`           // all the others are rejected if not empty
+		Deny           []string `yaml:"deny"`            // checked before allow
+		TrustedProxies []string `yaml:"trusted_proxies"` // the peers whose forwarded client ip is trusted, for allow and the rate limits by ip
+		File           string   `yaml:"file"`            // json or yaml by the extension
+		RedisKey       string   `yaml:"redis_key"`       // in the redis of the server
+	}
+
+	// RpcCacheRedisConf sets the RPC cache backend, by Redis by default
 	RpcCacheRedisConf struct {
 		RedisType   string            `yaml:"redis_type"` // cluster or ring, default is ring
 		Enabled     bool              `yaml:"enabled"`
 		Addrs       map[string]string `yaml:"addrs"`
 		Password    string            `yaml:"password"`
 		IdleTimeout int               `yaml:"idle_timeout"`
+		Store       string            `yaml:"store"`      // redis, lru or two_level of a local lru and the redis, default is redis
+		LocalSize   int               `yaml:"local_size"` // the keys of the local lru at most, default is 10000
+		LocalTTL    int64             `yaml:"local_ttl"`  // seconds the two_level keeps a key in the local lru at most, default is 10
 	}
 
 	EventConf struct {
@@ -89,6 +112,31 @@ type (
 		GateAddr string `yaml:"gate_addr"`
 		Interval int64  `yaml:"interval"`
 	}
+
+	// RetryConf sets how the failed calls of a method are retried
+	RetryConf struct {
+		Method      string   `yaml:"method"`       // the full method like /package.Service/Method, * matches all
+		MaxAttempts int      `yaml:"max_attempts"` // including the first call
+		BackoffBase int64    `yaml:"backoff_base"` // milliseconds
+		BackoffMax  int64    `yaml:"backoff_max"`  // milliseconds
+		Jitter      float64  `yaml:"jitter"`       // in [0, 1], default is 0.2
+		Codes       []string `yaml:"codes"`        // like Unavailable, default are Unavailable and ResourceExhausted
+	}
+
+	// TLSConf sets the transport security, the files are reloaded when they change
+	TLSConf struct {
+		CertFile          string `yaml:"cert_file"`
+		KeyFile           string `yaml:"key_file"`
+		CAFile            string `yaml:"ca_file"`             // verifies the peer, the system roots are used if empty on client side
+		ServerName        string `yaml:"server_name"`         // client side only, overrides the name to verify
+		RequireClientCert bool   `yaml:"require_client_cert"` // server side only, enables the mutual TLS
+	}
+
+	// DiscovConf sets the registry used by the discov:/// targets
+	DiscovConf struct {
+		Type string `yaml:"type"` // file or memory, empty disables the discovery
+		Path string `yaml:"path"` // the registry file, only used by the file type
+	}
 )
 
 type (
@@ -102,6 +150,14 @@ type (
 		// milliseconds
 		Timeout      int64 `yaml:"timeout"`
 		CpuThreshold int64 `yaml:"cpu_threshold"`
+		// the json responses use the proto field names, and render the zero values
+		OrigName     bool `yaml:"orig_name"`
+		EmitDefaults bool `yaml:"emit_defaults"`
+		// the peers whose X-Forwarded-For is trusted for the client ip, the peer itself otherwise
+		TrustedProxies []string `yaml:"trusted_proxies"`
+		// the client side TLS dialing the grpc server when serving as its gateway, with a client certificate
+		// if the server requires one, the CA and server_name of the server are used if empty
+		TLS TLSConf `yaml:"tls"`
 	}
 
 	RpcServerConf struct {
@@ -112,25 +168,44 @@ type (
 		Prometheus    PrometheusConf    `yaml:"prometheus"`
 		ListenOn      string            `yaml:"listenon"`
 		Auth          bool              `yaml:"auth"`
+		AuthApps      map[string]string `yaml:"auth_apps"` // the apps allowed to call when auth is on, app -> token
 		Redis         RedisConf         `yaml:"redis"`
 		Mysql         MysqlConf         `yaml:"mysql"`
 		Es            EsConf            `yaml:"es"`
 		NsqConsumer   NsqConsumerConf   `yaml:"nsq_consumer"`
 		NsqProducer   NsqProducerConf   `yaml:"nsq_producer"`
 		StrictControl bool              `yaml:"strict_control"`
-		Timeout       int64             `yaml:"timeout"` // never set it to 0, if zero, the underlying will set to 2s automatically
+		Timeout       int64             `yaml:"timeout"`  // never set it to 0, if zero, the underlying will set to 2s automatically
+		Timeouts      map[string]int64  `yaml:"timeouts"` // full method -> milliseconds, overrides Timeout, not positive for no timeout
 		RpcCacheRedis RpcCacheRedisConf `yaml:"rpc_cache_redis"`
 		Cos           COSConf           `yaml:"cos"`
+		Discov        DiscovConf        `yaml:"discov"`
+		TLS           TLSConf           `yaml:"tls"`
+		Reflection    bool              `yaml:"reflection"`    // register the grpc server reflection, for the tools like grpcurl
+		CpuThreshold  int64             `yaml:"cpu_threshold"` // the cpu usage in millicpu to shed the load, like 900, 0 to disable
+		RateLimits    []RateLimitConf   `yaml:"rate_limits"`
+		IPFilter      IPFilterConf      `yaml:"ip_filter"`
+		StreamTimeout int64             `yaml:"stream_timeout"` // seconds a stream lasts at most, overridden by Timeouts, 0 for no timeout
+		StreamIdle    int64             `yaml:"stream_idle"`    // seconds a stream goes without any message, 0 for no timeout
+		Gateway       RestConf          `yaml:"gateway"`        // serves the methods as http/json on the port if set
+		Validate      bool              `yaml:"validate"`       // validates the requests by Validate or ValidateAll, like protoc-gen-validate generates
+		ErrorMessages string            `yaml:"error_messages"` // the yaml or json file of the error messages by language, domain and code, see onecommon.Messages
 	}
 
 	RpcClientConf struct {
-		Endpoints []string `yaml:"endpoints"`
-		App       string   `yaml:"app"`
-		Token     string   `yaml:"token"`
-		Timeout   int64    `yaml:"timeout"`
-		Name      string   `yaml:"name"`
-		Env       string   `yaml:"env"` // prod or sit
-		PollSize  int64    `yaml:"poll_size"`
+		Endpoints  []string    `yaml:"endpoints"`
+		App        string      `yaml:"app"`
+		Token      string      `yaml:"token"`
+		Timeout    int64       `yaml:"timeout"`
+		Name       string      `yaml:"name"`
+		Env        string      `yaml:"env"` // prod or sit
+		PollSize   int64       `yaml:"poll_size"`
+		PoolPolicy string      `yaml:"pool_policy"` // round_robin or least_inflight, default is round_robin
+		Discov     DiscovConf  `yaml:"discov"`
+		Retries    []RetryConf `yaml:"retries"`
+		TLS        TLSConf     `yaml:"tls"`
+		// the codes counted as the breaker failures, like Internal, default are DeadlineExceeded, Unavailable and DataLoss
+		BreakerCodes []string `yaml:"breaker_codes"`
 	}
 )
 
@@ -138,6 +213,19 @@ func (cc RpcClientConf) HasCredential() bool {
 	return len(cc.App) > 0 && len(cc.Token) > 0
 }
 
+func (dc DiscovConf) Enabled() bool {
+	return len(dc.Type) > 0
+}
+
+func (ic IPFilterConf) Enabled() bool {
+	return len(ic.Allow) > 0 || len(ic.Deny) > 0 || len(ic.File) > 0 || len(ic.RedisKey) > 0
+}
+
+// Enabled tells whether the TLS is on, a client only needs the CA file, a server needs the certificate.
+func (tc TLSConf) Enabled() bool {
+	return len(tc.CertFile) > 0 || len(tc.CAFile) > 0
+}
+
 func ConfEnv() string {
 	if env := os.Getenv("CONFIGOR_ENV"); env != "" {
 		return env
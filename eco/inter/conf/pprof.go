@@ -6,6 +6,9 @@ import (
 	"os"
 )
 
+// StartPprof serves pprof on :6060 if OPEN_PPROF is 1.
+//
+// Deprecated: pprof is served by the admin server of the rpc server.
 func StartPprof() {
 	if os.Getenv("OPEN_PPROF") == "1" {
 		go func() {
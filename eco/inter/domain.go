@@ -0,0 +1,137 @@
+package onecommon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type (
+	// ErrDomain is the namespace of the Errs of a service, the codes are unique in a domain, and in its range.
+	ErrDomain struct {
+		Name string
+		Min  int
+		Max  int
+
+		lock sync.RWMutex
+		errs map[int]*Err
+	}
+
+	// ErrEntry describes a registered Err, see RegisteredErrs.
+	ErrEntry struct {
+		Domain   string            `json:"domain"`
+		Code     int               `json:"code"`
+		GrpcCode string            `json:"grpc_code"`
+		Message  string            `json:"message"`
+		Messages map[string]string `json:"messages,omitempty"` // language -> message, in the catalog of LoadMessages
+	}
+)
+
+var (
+	domainsLock sync.RWMutex
+	domains     = make(map[string]*ErrDomain)
+
+	// DefaultDomain is the domain of the built-in Errs, and the ones registered by NewErr.
+	DefaultDomain = RegisterDomain(ErrorDomain, 10000, 99999)
+)
+
+// RegisterDomain registers the domain name with the codes in [min, max], usually in the init of a service,
+// it panics if the name is registered already. The ranges of the domains may overlap, like the ones of
+// the services keeping their 6xxxx codes, and DefaultDomain of [10000, 99999], since the Errs are told
+// apart by the domain and the code, see Err.Is.
+func RegisterDomain(name string, min, max int) *ErrDomain {
+	if len(name) == 0 || min > max {
+		panic(fmt.Sprintf("invalid error domain %q [%d, %d]", name, min, max))
+	}
+
+	domainsLock.Lock()
+	defer domainsLock.Unlock()
+	if _, ok := domains[name]; ok {
+		panic(fmt.Sprintf("duplicated error domain %q", name))
+	}
+
+	d := &ErrDomain{
+		Name: name,
+		Min:  min,
+		Max:  max,
+		errs: make(map[int]*Err),
+	}
+	domains[name] = d
+	return d
+}
+
+// ErrDomains returns the registered domains, sorted by name.
+func ErrDomains() []*ErrDomain {
+	domainsLock.RLock()
+	list := make([]*ErrDomain, 0, len(domains))
+	for _, d := range domains {
+		list = append(list, d)
+	}
+	domainsLock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// RegisteredErrs returns all the registered Errs, sorted by domain and code.
+func RegisteredErrs() []ErrEntry {
+	messagesLock.RLock()
+	defer messagesLock.RUnlock()
+
+	var entries []ErrEntry
+	for _, d := range ErrDomains() {
+		for _, e := range d.Errs() {
+			entry := ErrEntry{
+				Domain:   d.Name,
+				Code:     e.Code,
+				GrpcCode: e.GrpcCode().String(),
+				Message:  e.Message,
+			}
+			for language, m := range messages {
+				if msg, ok := m[d.Name][e.Code]; ok {
+					if entry.Messages == nil {
+						entry.Messages = make(map[string]string)
+					}
+					entry.Messages[language] = msg
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// NewErr registers the Err of code in d, it panics if code is out of the range, or registered already.
+func (d *ErrDomain) NewErr(code int, msg string) *Err {
+	if code < d.Min || code > d.Max {
+		panic(fmt.Sprintf("error code %d out of the range [%d, %d] of domain %q", code, d.Min, d.Max, d.Name))
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.errs[code]; ok {
+		panic(fmt.Sprintf("duplicated error code %d in domain %q", code, d.Name))
+	}
+
+	e := &Err{Code: code, Message: msg, domain: d.Name}
+	d.errs[code] = e
+	return e
+}
+
+// Errs returns the Errs registered in d, sorted by code.
+func (d *ErrDomain) Errs() []*Err {
+	d.lock.RLock()
+	errs := make([]*Err, 0, len(d.errs))
+	for _, e := range d.errs {
+		errs = append(errs, e)
+	}
+	d.lock.RUnlock()
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Code < errs[j].Code
+	})
+	return errs
+}
@@ -2,6 +2,12 @@ package onecommon
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
 	"github.com/jinzhu/gorm"
 	"google.golang.org/grpc/status"
 )
@@ -18,6 +24,7 @@ import (
 // 604** 代表delegate错误
 // 依次类推f
 var (
+	// AllErrors is the codes and messages of the Errs in DefaultDomain.
 	AllErrors = make(map[int]string)
 
 	ErrOK                     = newErr(20000, "OK")
@@ -41,35 +48,79 @@ var (
 	ErTokenExpired            = newErr(50014, "Token 过期了")
 	ErrRpcCacheTimeout        = newErr(50015, "RPC cache timeout")
 	ErrServerTooBusy          = newErr(50016, "服务器正忙，请稍后再试")
+	ErrServiceUnavailable     = newErr(50017, "服务暂不可用，请稍后再试")
 
-	errorMapping map[string]*Err
+	errorMappings    []errorMapping
+	errorMappingLock sync.RWMutex
 )
 
+const maxStackDepth = 32
+
+// errorMapping maps the errors matching target by errors.Is to err
+type errorMapping struct {
+	target error
+	err    *Err
+}
+
 func init() {
-	errorMapping = make(map[string]*Err)
-	errorMapping[gorm.ErrRecordNotFound.Error()] = ErrNotFound
-	errorMapping[gorm.ErrInvalidSQL.Error()] = ErrDatabase
-	errorMapping[gorm.ErrInvalidTransaction.Error()] = ErrDatabase
-	errorMapping[gorm.ErrUnaddressable.Error()] = ErrDatabase
+	RegisterErrMapping(gorm.ErrRecordNotFound, ErrNotFound)
+	RegisterErrMapping(gorm.ErrInvalidSQL, ErrDatabase)
+	RegisterErrMapping(gorm.ErrInvalidTransaction, ErrDatabase)
+	RegisterErrMapping(gorm.ErrUnaddressable, ErrDatabase)
 }
 
 func newErr(code int, msg string) *Err {
-	if _, ok := AllErrors[code]; ok {
-		panic("Duplicated error code!!!")
-	}
+	e := DefaultDomain.NewErr(code, msg)
 	AllErrors[code] = msg
-	return &Err{code, msg}
+	return e
 }
 
-// NewErr registers a new ivanka error.
+// NewErr registers a new ivanka error in DefaultDomain, it panics if code is registered already.
+//
+// Deprecated: the codes collide across the services, use the NewErr of the ErrDomain of the service.
 func NewErr(code int, msg string) *Err {
 	return newErr(code, msg)
 }
 
-// Err represents the ivanka error.
+// RegisterErrMapping maps the errors of other libraries matching target by errors.Is to err in ErrFromGoErr,
+// the later registered ones are matched first.
+func RegisterErrMapping(target error, err *Err) {
+	errorMappingLock.Lock()
+	defer errorMappingLock.Unlock()
+	errorMappings = append(errorMappings, errorMapping{target: target, err: err})
+}
+
+// Err represents the ivanka error. The cause and the stack are only for the logs and sentry,
+// the clients get the code and the message only.
 type Err struct {
 	Code    int
 	Message string
+
+	domain string
+	cause  error
+	stack  []uintptr
+}
+
+// Wrap returns a copy of e caused by err, with the stack of the caller, nil if err is nil.
+func Wrap(err error, e *Err) *Err {
+	if err == nil {
+		return nil
+	}
+
+	return wrap(err, e, 3)
+}
+
+func wrap(err error, e *Err, skip int) *Err {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip, pcs)
+
+	return &Err{
+		Code:    e.Code,
+		Message: e.Message,
+		domain:  e.domain,
+		cause:   err,
+		stack:   pcs[:n],
+	}
 }
 
 func (e *Err) Error() string {
@@ -77,6 +128,52 @@ func (e *Err) Error() string {
 	return string(r)
 }
 
+// Unwrap returns the cause of e.
+func (e *Err) Unwrap() error {
+	return e.cause
+}
+
+// Domain returns the name of the ErrDomain of e, empty if unknown, like the ones by ErrFromString.
+func (e *Err) Domain() string {
+	return e.domain
+}
+
+// Is tells whether e has the same code as target, in the same domain if both are known, for errors.Is.
+func (e *Err) Is(target error) bool {
+	t, ok := target.(*Err)
+	if !ok || t == nil || t.Code != e.Code {
+		return false
+	}
+
+	return len(e.domain) == 0 || len(t.domain) == 0 || e.domain == t.domain
+}
+
+// StackTrace returns the program counters where e was wrapped, nil if not wrapped, which sentry reports as well.
+func (e *Err) StackTrace() []uintptr {
+	return e.stack
+}
+
+// Stack formats the stack where e was wrapped, one function and line per frame.
+func (e *Err) Stack() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+
+	var (
+		b      strings.Builder
+		frames = runtime.CallersFrames(e.stack)
+	)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
+
 // GetMessage fetches message from ivanka error.
 func (e Err) GetMessage() string {
 	return e.Message
@@ -86,32 +183,45 @@ func (e Err) GetMessage() string {
 func ErrFromString(str string) *Err {
 	var e Err
 	if err := json.Unmarshal([]byte(str), &e); err != nil || e.Code < 10000 {
-		return &Err{ErrInternalFromString.Code, str}
+		return &Err{Code: ErrInternalFromString.Code, Message: str}
 	}
 	return &e
 }
 
-// ErrFromGoErr transforms the golang error object to ivanka error.
+// ErrFromGoErr transforms the golang error object to ivanka error, the Err in the chain of err first,
+// then the registered mappings, see RegisterErrMapping, and the grpc statuses.
 func ErrFromGoErr(err error) *Err {
-	if ivankaErr, ok := errorMapping[err.Error()]; ok {
-		return ivankaErr
+	var e *Err
+	if errors.As(err, &e) {
+		return e
 	}
 
-	if e, ok := err.(*Err); ok {
-		return e
+	if mapped := mappedErr(err); mapped != nil {
+		return wrap(err, mapped, 3)
 	}
 
 	if e, ok := status.FromError(err); ok {
+		if ivankaErr, ok := ErrFromStatus(e); ok {
+			return ivankaErr
+		}
 		return ErrFromString(e.Message())
 	}
 	return ErrFromString(err.Error())
 }
 
-// IsIvankaErr indicates if the error is ivanka error.
-func IsIvankaErr(err error, ivkerr *Err) bool {
-	e, ok := err.(*Err)
-	if !ok {
-		return false
+func mappedErr(err error) *Err {
+	errorMappingLock.RLock()
+	defer errorMappingLock.RUnlock()
+	for i := len(errorMappings) - 1; i >= 0; i-- {
+		if errors.Is(err, errorMappings[i].target) {
+			return errorMappings[i].err
+		}
 	}
-	return e.Code == ivkerr.Code
+
+	return nil
+}
+
+// IsIvankaErr indicates if the error is ivanka error, or wraps one, with the same code as ivkerr.
+func IsIvankaErr(err error, ivkerr *Err) bool {
+	return errors.Is(err, ivkerr)
 }
@@ -0,0 +1,68 @@
+package onecommon
+
+import (
+	"sync"
+
+	"github.com/wednesdaysunny/onerpc/eco/inter/conf"
+)
+
+// Messages is the catalog of the error messages, language -> domain -> code -> message, like
+//
+//	en:
+//	  onerpc:
+//	    40400: The resource is not found
+//
+// The Errs of unknown domains, like the ones by ErrFromString, are in DefaultDomain.
+type Messages map[string]map[string]map[int]string
+
+var (
+	messagesLock sync.RWMutex
+	messages     Messages
+)
+
+// LoadMessages loads the catalog of the error messages from file, in yaml or json, see Messages.
+func LoadMessages(file string) error {
+	var m Messages
+	if err := conf.LoadConfig(file, &m); err != nil {
+		return err
+	}
+
+	SetMessages(m)
+	return nil
+}
+
+// SetMessages replaces the catalog of the error messages.
+func SetMessages(m Messages) {
+	messagesLock.Lock()
+	messages = m
+	messagesLock.Unlock()
+}
+
+// HasLanguage checks if the catalog has the messages of language.
+func HasLanguage(language string) bool {
+	messagesLock.RLock()
+	defer messagesLock.RUnlock()
+
+	_, ok := messages[language]
+	return ok
+}
+
+// Localize returns e with the message in language, or e itself if the catalog has no such message.
+func (e *Err) Localize(language string) *Err {
+	domain := e.domain
+	if len(domain) == 0 {
+		domain = ErrorDomain
+	}
+
+	messagesLock.RLock()
+	msg, ok := messages[language][domain][e.Code]
+	messagesLock.RUnlock()
+	if !ok || msg == e.Message {
+		return e
+	}
+
+	localized := *e
+	localized.Message = msg
+
+	return &localized
+}
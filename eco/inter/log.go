@@ -110,6 +110,22 @@ func InitLog(conf oconf.ConfigLog) {
 	}
 }
 
+// GetLogLevel returns the level of the logs, like info.
+func GetLogLevel() string {
+	return logrus.GetLevel().String()
+}
+
+// SetLogLevel sets the level of the logs at runtime, like debug.
+func SetLogLevel(level string) error {
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logrus.SetLevel(l)
+	return nil
+}
+
 func logName(path string, ip string, time time.Time) string {
 	year, month, day := time.Date()
 
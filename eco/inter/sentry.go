@@ -3,6 +3,7 @@ package onecommon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -106,3 +107,18 @@ func RecoverRepanicWithSentry(ctx context.Context, req interface{}) {
 func CaptureExceptionWithSentry(excp error) {
 	sentry.CaptureException(excp)
 }
+
+// CaptureErrWithSentry sends the Err wrapped by err to sentry if it has a cause, with the cause and the stack.
+func CaptureErrWithSentry(ctx context.Context, req interface{}, err error) {
+	var e *Err
+	if !errors.As(err, &e) || e.Unwrap() == nil {
+		return
+	}
+
+	hub := sentry.CurrentHub().Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetRequest(GenHttpRequestFromGrpcContext(ctx))
+		scope.SetRequestBody(MarshalGrpcReq(req))
+	})
+	hub.CaptureException(e)
+}
@@ -0,0 +1,123 @@
+package onecommon
+
+import (
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo carrying the Errs, and the name of DefaultDomain.
+const ErrorDomain = "onerpc"
+
+const (
+	errorInfoCode    = "code"
+	errorInfoMessage = "message"
+	errorInfoDomain  = "domain" // the ErrDomain of the Err
+)
+
+var (
+	// the grpc codes of the http status of the first three digits of the Err codes
+	httpGrpcCodes = map[int]codes.Code{
+		400: codes.InvalidArgument,
+		401: codes.Unauthenticated,
+		403: codes.PermissionDenied,
+		404: codes.NotFound,
+		408: codes.DeadlineExceeded,
+		409: codes.AlreadyExists,
+		412: codes.FailedPrecondition,
+		429: codes.ResourceExhausted,
+		499: codes.Canceled,
+		500: codes.Internal,
+		501: codes.Unimplemented,
+		503: codes.Unavailable,
+		504: codes.DeadlineExceeded,
+	}
+
+	// the built-in Errs not meaning their http status, like the 500xx ones caused by the callers,
+	// only for the ones in DefaultDomain
+	errGrpcCodes = map[int]codes.Code{
+		ErrBanIp.Code:              codes.PermissionDenied,
+		ErrIllegalJson.Code:        codes.InvalidArgument,
+		ErrParams.Code:             codes.InvalidArgument,
+		ErrIllegalToken.Code:       codes.Unauthenticated,
+		ErrNotImplemented.Code:     codes.Unimplemented,
+		ErrNoData.Code:             codes.NotFound,
+		ErrDumplicate.Code:         codes.AlreadyExists,
+		ErrOtherClientSignIn.Code:  codes.Unauthenticated,
+		ErrUserBan.Code:            codes.PermissionDenied,
+		ErTokenExpired.Code:        codes.Unauthenticated,
+		ErrRpcCacheTimeout.Code:    codes.DeadlineExceeded,
+		ErrServerTooBusy.Code:      codes.ResourceExhausted,
+		ErrServiceUnavailable.Code: codes.Unavailable,
+	}
+)
+
+// GrpcCode returns the grpc code of e, by the http status of the first three digits of its code,
+// like NotFound for 404xx and Internal for 500xx. The other 4xx are FailedPrecondition, the other 5xx
+// are Internal, and the others, like the 6xxxx business errors, are Unknown.
+func (e *Err) GrpcCode() codes.Code {
+	if len(e.domain) == 0 || e.domain == ErrorDomain {
+		if code, ok := errGrpcCodes[e.Code]; ok {
+			return code
+		}
+	}
+
+	httpStatus := e.Code / 100
+	if code, ok := httpGrpcCodes[httpStatus]; ok {
+		return code
+	}
+
+	switch {
+	case httpStatus >= 400 && httpStatus < 500:
+		return codes.FailedPrecondition
+	case httpStatus >= 500 && httpStatus < 600:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
+// Status converts e to a grpc status of GrpcCode, with the code, message and domain in google.rpc.ErrorInfo.
+// The message of the status is still the json of e, for the clients parsing it by ErrFromString.
+func (e *Err) Status() *status.Status {
+	st := status.New(e.GrpcCode(), e.Error())
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: strconv.Itoa(e.Code),
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			errorInfoCode:    strconv.Itoa(e.Code),
+			errorInfoMessage: e.Message,
+			errorInfoDomain:  e.domain,
+		},
+	})
+	if err != nil {
+		return st
+	}
+
+	return detailed
+}
+
+// ErrFromStatus rebuilds the Err from the google.rpc.ErrorInfo of st, see Err.Status.
+func ErrFromStatus(st *status.Status) (*Err, bool) {
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.GetDomain() != ErrorDomain {
+			continue
+		}
+
+		code, err := strconv.Atoi(info.GetMetadata()[errorInfoCode])
+		if err != nil {
+			continue
+		}
+
+		return &Err{
+			Code:    code,
+			Message: info.GetMetadata()[errorInfoMessage],
+			domain:  info.GetMetadata()[errorInfoDomain],
+		}, true
+	}
+
+	return nil, false
+}
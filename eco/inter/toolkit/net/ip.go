@@ -212,3 +212,39 @@ func IsPrivateIpv4(ip string) bool {
 	}
 	return false
 }
+
+// ParseCIDRs parses the CIDRs, the bare IPs are taken as the single address blocks.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", cidr)
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, nil
+}
+
+// IsIPWithin checks if ip is within any of the subnets.
+func IsIPWithin(ip net.IP, subnets []*net.IPNet) bool {
+	return isIPWithin(ip, subnets)
+}
@@ -0,0 +1,92 @@
+package window
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Bucket aggregates the values added in one time slot of the window.
+	Bucket struct {
+		Sum   float64
+		Count int64
+	}
+
+	// RollingWindow keeps the values of the last size*interval, slot by slot,
+	// the expired slots are reset lazily when the window is touched.
+	RollingWindow struct {
+		lock     sync.RWMutex
+		size     int
+		interval time.Duration
+		buckets  []Bucket
+		offset   int
+		lastTime time.Time
+	}
+)
+
+func NewRollingWindow(size int, interval time.Duration) *RollingWindow {
+	if size < 1 {
+		panic("window size must be greater than 0")
+	}
+
+	return &RollingWindow{
+		size:     size,
+		interval: interval,
+		buckets:  make([]Bucket, size),
+		lastTime: time.Now(),
+	}
+}
+
+// Add adds v to the current slot.
+func (rw *RollingWindow) Add(v float64) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.updateOffset()
+	rw.buckets[rw.offset].Sum += v
+	rw.buckets[rw.offset].Count++
+}
+
+// Reduce walks through the slots that are not expired, from the oldest to the latest.
+func (rw *RollingWindow) Reduce(fn func(b *Bucket)) {
+	rw.lock.RLock()
+	defer rw.lock.RUnlock()
+
+	span := rw.span()
+	// skip the slots that expired since the last update
+	for i := span; i < rw.size; i++ {
+		fn(&rw.buckets[(rw.offset+1+i)%rw.size])
+	}
+}
+
+// Interval returns the time span of one slot.
+func (rw *RollingWindow) Interval() time.Duration {
+	return rw.interval
+}
+
+func (rw *RollingWindow) span() int {
+	offset := int(time.Since(rw.lastTime) / rw.interval)
+	if offset > rw.size {
+		return rw.size
+	}
+
+	return offset
+}
+
+func (rw *RollingWindow) updateOffset() {
+	elapsed := int(time.Since(rw.lastTime) / rw.interval)
+	if elapsed <= 0 {
+		return
+	}
+
+	span := elapsed
+	if span > rw.size {
+		span = rw.size
+	}
+	for i := 0; i < span; i++ {
+		rw.buckets[(rw.offset+1+i)%rw.size] = Bucket{}
+	}
+	rw.offset = (rw.offset + elapsed) % rw.size
+	// align to the start of the slot, so that the slots never drift
+	rw.lastTime = rw.lastTime.Add(time.Duration(elapsed) * rw.interval)
+}
@@ -0,0 +1,53 @@
+package window
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sum(rw *RollingWindow) (float64, int64) {
+	var (
+		total float64
+		count int64
+	)
+	rw.Reduce(func(b *Bucket) {
+		total += b.Sum
+		count += b.Count
+	})
+
+	return total, count
+}
+
+func TestRollingWindow(t *testing.T) {
+	const interval = time.Millisecond * 50
+	rw := NewRollingWindow(3, interval)
+	rw.Add(1)
+	rw.Add(2)
+	total, count := sum(rw)
+	assert.Equal(t, float64(3), total)
+	assert.Equal(t, int64(2), count)
+
+	time.Sleep(interval)
+	rw.Add(3)
+	total, count = sum(rw)
+	assert.Equal(t, float64(6), total)
+	assert.Equal(t, int64(3), count)
+
+	time.Sleep(interval * 4)
+	total, count = sum(rw)
+	assert.Equal(t, float64(0), total)
+	assert.Equal(t, int64(0), count)
+
+	rw.Add(4)
+	total, count = sum(rw)
+	assert.Equal(t, float64(4), total)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRollingWindowSize(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRollingWindow(0, time.Second)
+	})
+}
@@ -0,0 +1,81 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	"github.com/wednesdaysunny/onerpc/eco/credential"
+	"google.golang.org/grpc"
+)
+
+// the health probes, like the ones from kubernetes, carry no credentials
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+func UnaryAuthorizeInterceptor(authenticator *credential.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorize(ctx, info.FullMethod, authenticator); err != nil {
+			return nil, toStatusError(err)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func StreamAuthorizeInterceptor(authenticator *credential.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		if err := authorize(stream.Context(), info.FullMethod, authenticator); err != nil {
+			return toStatusError(err)
+		}
+
+		return handler(srv, stream)
+	}
+}
+
+// IsAuthExempt checks if the full method is called without authentication, like the health checks.
+func IsAuthExempt(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, healthServicePrefix)
+}
+
+// authorize checks the call by authenticator, the failed ones are counted by the app and the reason,
+// even if allowed in non-strict mode.
+func authorize(ctx context.Context, method string, authenticator *credential.Authenticator) error {
+	if IsAuthExempt(method) {
+		return nil
+	}
+
+	r := authenticator.Check(ctx)
+	if r == nil {
+		return nil
+	}
+
+	observeAuthRejected(method, r)
+	return authenticator.Reject(r)
+}
+
+func observeAuthRejected(method string, r *credential.Rejection) {
+	if !isPrometheusEnabled() {
+		return
+	}
+
+	// any app may be claimed, keep the labels bounded
+	app := r.App
+	if r.Reason == credential.ReasonUnknownApp {
+		app = UNKNOWN
+	}
+	labels, lerr := AuthRejectedLabels.CreatePromLabels(map[string]string{
+		LabelNamespace:  "one",
+		LabelSourceApp:  svcName,
+		LabelMethod:     method,
+		LabelApp:        app,
+		LabelAuthReason: r.Reason,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+
+	GetPromMonitor().IncrAuthRejected(labels)
+}
@@ -0,0 +1,101 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/prometheus/common/log"
+	"github.com/wednesdaysunny/onerpc/eco/breaker"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the codes counted as the breaker failures by default, Internal is left out, since the unmapped 5xx Errs
+// of the services are Internal too, which mostly mean the business failures rather than a broken server
+var defaultBreakerCodes = []codes.Code{codes.DeadlineExceeded, codes.Unavailable, codes.DataLoss}
+
+// BreakerInterceptor breaks the calls per target and method, the errors of failureCodes, or DeadlineExceeded,
+// Unavailable and DataLoss if empty, count as failures, and the dropped calls fail fast with ErrServiceUnavailable.
+func BreakerInterceptor(target string, failureCodes []codes.Code) grpc.UnaryClientInterceptor {
+	acceptable := breakerAcceptable(failureCodes)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		brk := breaker.GetBreaker(path.Join(target, method))
+		err := brk.DoWithAcceptable(func() error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}, acceptable)
+		observeBreaker(brk, target, method, err)
+
+		return err
+	}
+}
+
+// StreamBreakerInterceptor breaks the stream creations per target and method, see BreakerInterceptor.
+func StreamBreakerInterceptor(target string, failureCodes []codes.Code) grpc.StreamClientInterceptor {
+	acceptable := breakerAcceptable(failureCodes)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var stream grpc.ClientStream
+		brk := breaker.GetBreaker(path.Join(target, method))
+		err := brk.DoWithAcceptable(func() error {
+			var err error
+			stream, err = streamer(ctx, desc, cc, method, opts...)
+			return err
+		}, acceptable)
+		observeBreaker(brk, target, method, err)
+
+		return stream, err
+	}
+}
+
+// BreakerCodesFromConf converts the names of the breaker failure codes, the unknown ones are reported as error.
+func BreakerCodesFromConf(names []string) ([]codes.Code, error) {
+	var failureCodes []codes.Code
+	for _, name := range names {
+		code, ok := parseCode(name)
+		if !ok {
+			return nil, fmt.Errorf("breaker: unknown code %q", name)
+		}
+
+		failureCodes = append(failureCodes, code)
+	}
+
+	return failureCodes, nil
+}
+
+// breakerAcceptable returns the errors not counted as the breaker failures, the ones not of failureCodes.
+func breakerAcceptable(failureCodes []codes.Code) breaker.Acceptable {
+	if len(failureCodes) == 0 {
+		failureCodes = defaultBreakerCodes
+	}
+
+	return func(err error) bool {
+		return !hasCode(failureCodes, status.Code(err))
+	}
+}
+
+func observeBreaker(brk *breaker.Breaker, target, method string, err error) {
+	if !isPrometheusEnabled() {
+		return
+	}
+
+	labels, lerr := BreakerLabels.CreatePromLabels(map[string]string{
+		LabelNamespace: "one",
+		LabelSourceApp: svcName,
+		LabelTarget:    target,
+		LabelMethod:    method,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+
+	metricClient := GetPromMonitor()
+	metricClient.SetBreakerDropRatio(labels, brk.DropRatio())
+	if std.IsIvankaErr(err, std.ErrServiceUnavailable) {
+		metricClient.IncrBreakerRejected(labels)
+	}
+}
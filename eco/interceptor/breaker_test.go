@@ -0,0 +1,37 @@
+package interceptor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreakerAcceptable(t *testing.T) {
+	acceptable := breakerAcceptable(nil)
+	assert.True(t, acceptable(nil))
+	assert.True(t, acceptable(status.Error(codes.NotFound, "not found")))
+	assert.False(t, acceptable(status.Error(codes.Unavailable, "unavailable")))
+	assert.False(t, acceptable(status.Error(codes.DeadlineExceeded, "deadline")))
+	// the unmapped 5xx Errs are Internal, not the failures unless configured
+	bizErr := std.ErrInternal.Status().Err()
+	assert.Equal(t, codes.Internal, status.Code(bizErr))
+	assert.True(t, acceptable(bizErr))
+	assert.True(t, acceptable(errors.New("not a status")))
+
+	acceptable = breakerAcceptable([]codes.Code{codes.Internal, codes.Unavailable})
+	assert.False(t, acceptable(bizErr))
+	assert.True(t, acceptable(status.Error(codes.DeadlineExceeded, "deadline")))
+}
+
+func TestBreakerCodesFromConf(t *testing.T) {
+	failureCodes, err := BreakerCodesFromConf([]string{"Internal", "Unavailable"})
+	assert.Nil(t, err)
+	assert.Equal(t, []codes.Code{codes.Internal, codes.Unavailable}, failureCodes)
+
+	_, err = BreakerCodesFromConf([]string{"Broken"})
+	assert.NotNil(t, err)
+}
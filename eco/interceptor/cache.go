@@ -13,8 +13,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	jsoniter "github.com/json-iterator/go"
 	stdc "github.com/wednesdaysunny/onerpc/eco/inter/common"
-	cache "gopkg.in/go-redis/cache.v5"
-	redis "gopkg.in/redis.v5"
+	"go4.org/syncutil/singleflight"
 
 	std "github.com/wednesdaysunny/onerpc/eco/inter"
 	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
@@ -41,7 +40,8 @@ type CacheSetting struct {
 
 type CacheManager struct {
 	enabled bool
-	codec   *cache.Codec
+	store   CacheStore
+	group   singleflight.Group
 	config  map[string]CacheSetting
 }
 
@@ -50,62 +50,33 @@ type cachedObj struct {
 	IvkErr *std.Err
 }
 
-func InitCache(conf oconf.RpcCacheRedisConf) {
+// InitCache enables the cache by the store of conf if enabled, see NewCacheStore,
+// the error of the store is returned, like the unknown ones, and nothing is initialized.
+func InitCache(conf oconf.RpcCacheRedisConf) error {
+	var store CacheStore
+	if conf.Enabled {
+		var err error
+		if store, err = NewCacheStore(conf); err != nil {
+			return err
+		}
+	}
+
+	InitCacheStore(store)
+	return nil
+}
+
+// InitCacheStore enables the cache by store, or disables it if nil,
+// only the first call of InitCacheStore and InitCache takes effect.
+func InitCacheStore(store CacheStore) {
 	cacheLock.Lock()
 	defer cacheLock.Unlock()
 	if CacheMgrIns != nil {
 		return
 	}
 
-	if !conf.Enabled {
-		CacheMgrIns = &CacheManager{}
-	} else {
-		marshal := func(v interface{}) ([]byte, error) {
-			if _, ok := v.(*cachedObj); !ok {
-				return nil, std.ErrRpcCacheMarshal
-			} else if b, err := json.Marshal(v); err != nil {
-				return nil, std.ErrRpcCacheMarshal
-			} else {
-				return b, nil
-			}
-		}
-		unmarshal := func(b []byte, v interface{}) error {
-			if _, ok := v.(*cachedObj); !ok {
-				return std.ErrRpcCacheUnmarshal
-			} else if err := json.Unmarshal(b, v); err != nil {
-				return std.ErrRpcCacheUnmarshal
-			} else {
-				return nil
-			}
-		}
-		var codec = &cache.Codec{
-			Marshal:   marshal,
-			Unmarshal: unmarshal,
-		}
-		if conf.RedisType == "cluster" {
-			var addrs []string
-			for _, v := range conf.Addrs {
-				addrs = append(addrs, v)
-			}
-			rc := redis.NewClusterClient(&redis.ClusterOptions{
-				Addrs:       addrs,
-				Password:    conf.Password,
-				IdleTimeout: time.Second * time.Duration(conf.IdleTimeout),
-			})
-			codec.Redis = rc
-		} else {
-			rc := redis.NewRing(&redis.RingOptions{
-				Addrs:       conf.Addrs,
-				Password:    conf.Password,
-				IdleTimeout: time.Second * time.Duration(conf.IdleTimeout),
-			})
-			codec.Redis = rc
-		}
-
-		CacheMgrIns = &CacheManager{
-			enabled: true,
-			codec:   codec,
-		}
+	CacheMgrIns = &CacheManager{
+		enabled: store != nil,
+		store:   store,
 	}
 }
 
@@ -125,6 +96,65 @@ func ConfigRpcCache(settings []CacheSetting) {
 	CacheMgrIns.config = conf
 }
 
+// CacheSettingOf returns the cache setting of the full method, like /package.service/method,
+// only if the cache is enabled and the setting takes effect.
+func CacheSettingOf(fullMethod string) (CacheSetting, bool) {
+	if CacheMgrIns == nil || !CacheMgrIns.enabled {
+		return CacheSetting{}, false
+	}
+
+	setting, ok := CacheMgrIns.config[settingName(fullMethod)]
+	if !ok || setting.Expiration <= 0 {
+		return CacheSetting{}, false
+	}
+
+	return setting, true
+}
+
+// do returns the cached object of key, or calls fn and caches its object in ttl, the calls of the same key
+// are in flight once at a time.
+func (m *CacheManager) do(key string, ttl time.Duration, fn func() (interface{}, error)) (interface{}, error) {
+	if obj, ok := m.get(key); ok {
+		return obj, nil
+	}
+
+	return m.group.Do(key, func() (interface{}, error) {
+		if obj, ok := m.get(key); ok {
+			return obj, nil
+		}
+
+		obj, err := fn()
+		if err != nil {
+			return nil, err
+		}
+
+		if b, err := json.Marshal(obj); err != nil {
+			std.LogErrorc("rpc", err, "rpc cache: fail to marshal")
+		} else if err := m.store.Set(key, b, ttl); err != nil {
+			std.LogErrorc("rpc", err, "rpc cache: fail to set")
+		}
+		return obj, nil
+	})
+}
+
+func (m *CacheManager) get(key string) (*cachedObj, bool) {
+	b, err := m.store.Get(key)
+	if err != nil {
+		if err != ErrCacheMiss {
+			std.LogErrorc("rpc", err, "rpc cache: fail to get")
+		}
+		return nil, false
+	}
+
+	var obj cachedObj
+	if err := json.Unmarshal(b, &obj); err != nil {
+		std.LogErrorc("rpc", err, "rpc cache: fail to unmarshal")
+		return nil, false
+	}
+
+	return &obj, true
+}
+
 type ret struct {
 	obj interface{}
 	err error
@@ -157,44 +187,39 @@ func CacheUnaryServerInterceptor() grpc.UnaryServerInterceptor {
 			std.LogErrorc("redis", err, "fail to fetch rpc content from cache")
 			return nil, err
 		} else {
-			v, err := CacheMgrIns.codec.Do(&cache.Item{
-				Key:        key,
-				Object:     new(cachedObj), // destination
-				Expiration: settings.Expiration,
-				Func: func() (interface{}, error) {
-					retChan := make(chan ret, 1)
-					go func() {
-						defer func() {
-							if e := recover(); e != nil {
-								std.LogRecover(e)
-							}
-						}()
-
-						rsp, err = handler(ctx, req)
-						retChan <- ret{rsp, err}
+			v, err := CacheMgrIns.do(key, settings.Expiration, func() (interface{}, error) {
+				retChan := make(chan ret, 1)
+				go func() {
+					defer func() {
+						if e := recover(); e != nil {
+							std.LogRecover(e)
+						}
 					}()
 
-					timeout := settings.Expiration / 2
-					select {
-					case ret := <-retChan:
-						var cobj cachedObj
-						if ret.err != nil {
-							cobj.IvkErr = std.ErrFromGoErr(ret.err)
-							if std.IsIvankaErr(cobj.IvkErr, std.ErrInternalFromString) {
-								return ret.obj, ret.err
-							}
-						} else {
-							cobj.Data, err = toolkit.MarshalResp(ret.obj)
-							if err != nil {
-								return nil, err
-							}
+					rsp, err = handler(ctx, req)
+					retChan <- ret{rsp, err}
+				}()
+
+				timeout := settings.Expiration / 2
+				select {
+				case ret := <-retChan:
+					var cobj cachedObj
+					if ret.err != nil {
+						cobj.IvkErr = std.ErrFromGoErr(ret.err)
+						if std.IsIvankaErr(cobj.IvkErr, std.ErrInternalFromString) {
+							return ret.obj, ret.err
+						}
+					} else {
+						cobj.Data, err = toolkit.MarshalResp(ret.obj)
+						if err != nil {
+							return nil, err
 						}
-						return &cobj, nil
-					case <-time.After(timeout):
-						std.LogErrorc("rpc", nil, fmt.Sprintf("fail to call rpc %s: timeout", settingKey))
-						return nil, std.ErrRpcCacheTimeout
 					}
-				},
+					return &cobj, nil
+				case <-time.After(timeout):
+					std.LogErrorc("rpc", nil, fmt.Sprintf("fail to call rpc %s: timeout", settingKey))
+					return nil, std.ErrRpcCacheTimeout
+				}
 			})
 			if err != nil {
 				if std.IsIvankaErr(err, std.ErrRpcCacheTimeout) {
@@ -0,0 +1,343 @@
+package interceptor
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	redis "gopkg.in/redis.v5"
+)
+
+const (
+	CacheStoreRedis    = "redis"
+	CacheStoreLRU      = "lru"
+	CacheStoreTwoLevel = "two_level"
+
+	defaultLRUSize  = 10000
+	defaultLocalTTL = time.Second * 10
+
+	// gets the value with its ttl in milliseconds in one round trip, nil if missing, -1 for the ttl if never expires
+	getWithTTLScript = `local value = redis.call('GET', KEYS[1])
+if not value then
+	return nil
+end
+return {value, redis.call('PTTL', KEYS[1])}`
+)
+
+var ErrCacheMiss = errors.New("cache: key is missing")
+
+type (
+	// CacheStore stores the cached responses by key, Get and TTL return ErrCacheMiss
+	// if the key is missing or expired.
+	CacheStore interface {
+		Get(key string) ([]byte, error)
+		Set(key string, value []byte, ttl time.Duration) error
+		Delete(key string) error
+		// TTL returns the time to live of key, 0 if it never expires.
+		TTL(key string) (time.Duration, error)
+	}
+
+	// ttlGetter gets the value and the time to live of key in one call, like the redis store
+	// in one round trip, see CacheStore.
+	ttlGetter interface {
+		GetWithTTL(key string) ([]byte, time.Duration, error)
+	}
+
+	lruEntry struct {
+		key      string
+		value    []byte
+		expireAt time.Time
+	}
+
+	// lruStore is the in-process store, which evicts the least recently used keys beyond its size.
+	lruStore struct {
+		lock    sync.Mutex
+		size    int
+		list    *list.List
+		entries map[string]*list.Element
+	}
+
+	// CacheRedisClient is the commands used of the redis clients, like the ring and cluster ones.
+	CacheRedisClient interface {
+		Get(key string) *redis.StringCmd
+		Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+		Del(keys ...string) *redis.IntCmd
+		TTL(key string) *redis.DurationCmd
+		Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+	}
+
+	redisStore struct {
+		client CacheRedisClient
+	}
+
+	// twoLevelStore reads through the local store to the remote one, the local entries live
+	// localTTL at most, so the changes of the remote ones are seen in localTTL.
+	twoLevelStore struct {
+		local    CacheStore
+		remote   CacheStore
+		localTTL time.Duration
+	}
+)
+
+// NewCacheStore creates the store of conf, by its Store, redis by default.
+func NewCacheStore(conf oconf.RpcCacheRedisConf) (CacheStore, error) {
+	switch conf.Store {
+	case "", CacheStoreRedis:
+		return NewRedisStore(newCacheRedis(conf)), nil
+	case CacheStoreLRU:
+		return NewLRUStore(conf.LocalSize), nil
+	case CacheStoreTwoLevel:
+		return NewTwoLevelStore(NewLRUStore(conf.LocalSize), NewRedisStore(newCacheRedis(conf)),
+			time.Duration(conf.LocalTTL)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("rpc cache: unknown store %q", conf.Store)
+	}
+}
+
+// NewLRUStore creates the in-process store of size keys at most, 10000 if not positive.
+func NewLRUStore(size int) CacheStore {
+	if size <= 0 {
+		size = defaultLRUSize
+	}
+
+	return &lruStore{
+		size:    size,
+		list:    list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (s *lruStore) Get(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+
+	s.list.MoveToFront(s.entries[key])
+	return entry.value, nil
+}
+
+func (s *lruStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expireAt = time.Now().Add(ttl)
+	}
+	if el, ok := s.entries[key]; ok {
+		el.Value = entry
+		s.list.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.list.PushFront(entry)
+	for s.list.Len() > s.size {
+		s.remove(s.list.Back())
+	}
+	return nil
+}
+
+func (s *lruStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+func (s *lruStore) TTL(key string) (time.Duration, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	if entry.expireAt.IsZero() {
+		return 0, nil
+	}
+
+	return time.Until(entry.expireAt), nil
+}
+
+// get returns the entry of key, and removes it if expired, s.lock must be held.
+func (s *lruStore) get(key string) (*lruEntry, bool) {
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if !entry.expireAt.IsZero() && !time.Now().Before(entry.expireAt) {
+		s.remove(el)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func (s *lruStore) remove(el *list.Element) {
+	s.list.Remove(el)
+	delete(s.entries, el.Value.(*lruEntry).key)
+}
+
+// NewRedisStore creates the store by client, like a redis ring or cluster client.
+func NewRedisStore(client CacheRedisClient) CacheStore {
+	return redisStore{client: client}
+}
+
+func (s redisStore) Get(key string) ([]byte, error) {
+	b, err := s.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+
+	return b, err
+}
+
+func (s redisStore) Set(key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(key, value, ttl).Err()
+}
+
+func (s redisStore) Delete(key string) error {
+	return s.client.Del(key).Err()
+}
+
+func (s redisStore) TTL(key string) (time.Duration, error) {
+	ttl, err := s.client.TTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// -2 if the key is missing, and -1 if it never expires
+	switch {
+	case ttl == -2*time.Second:
+		return 0, ErrCacheMiss
+	case ttl < 0:
+		return 0, nil
+	default:
+		return ttl, nil
+	}
+}
+
+// GetWithTTL gets the value and the time to live of key by a script, in one round trip.
+func (s redisStore) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	result, err := s.client.Eval(getWithTTLScript, []string{key}).Result()
+	if err == redis.Nil {
+		return nil, 0, ErrCacheMiss
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, 0, fmt.Errorf("cache: unexpected result %v of key %s", result, key)
+	}
+	value, ok := values[0].(string)
+	if !ok {
+		return nil, 0, fmt.Errorf("cache: unexpected value %v of key %s", values[0], key)
+	}
+	pttl, ok := values[1].(int64)
+	if !ok {
+		return nil, 0, fmt.Errorf("cache: unexpected ttl %v of key %s", values[1], key)
+	}
+	if pttl < 0 {
+		return []byte(value), 0, nil
+	}
+
+	return []byte(value), time.Duration(pttl) * time.Millisecond, nil
+}
+
+// NewTwoLevelStore creates the store reading local first then remote, localTTL is 10 seconds if not positive.
+func NewTwoLevelStore(local, remote CacheStore, localTTL time.Duration) CacheStore {
+	if localTTL <= 0 {
+		localTTL = defaultLocalTTL
+	}
+
+	return twoLevelStore{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+	}
+}
+
+func (s twoLevelStore) Get(key string) ([]byte, error) {
+	if b, err := s.local.Get(key); err == nil {
+		return b, nil
+	}
+
+	// the value and the ttl in one round trip if the remote supports
+	if getter, ok := s.remote.(ttlGetter); ok {
+		b, ttl, err := getter.GetWithTTL(key)
+		if err != nil {
+			return nil, err
+		}
+
+		s.local.Set(key, b, s.localTTLOf(ttl))
+		return b, nil
+	}
+
+	b, err := s.remote.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ttl, err := s.remote.TTL(key); err == nil {
+		s.local.Set(key, b, s.localTTLOf(ttl))
+	}
+
+	return b, nil
+}
+
+func (s twoLevelStore) Set(key string, value []byte, ttl time.Duration) error {
+	if err := s.remote.Set(key, value, ttl); err != nil {
+		return err
+	}
+
+	return s.local.Set(key, value, s.localTTLOf(ttl))
+}
+
+func (s twoLevelStore) Delete(key string) error {
+	s.local.Delete(key)
+	return s.remote.Delete(key)
+}
+
+func (s twoLevelStore) TTL(key string) (time.Duration, error) {
+	return s.remote.TTL(key)
+}
+
+func (s twoLevelStore) localTTLOf(ttl time.Duration) time.Duration {
+	if ttl > 0 && ttl < s.localTTL {
+		return ttl
+	}
+
+	return s.localTTL
+}
+
+func newCacheRedis(conf oconf.RpcCacheRedisConf) CacheRedisClient {
+	if conf.RedisType == "cluster" {
+		var addrs []string
+		for _, v := range conf.Addrs {
+			addrs = append(addrs, v)
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:       addrs,
+			Password:    conf.Password,
+			IdleTimeout: time.Second * time.Duration(conf.IdleTimeout),
+		})
+	}
+
+	return redis.NewRing(&redis.RingOptions{
+		Addrs:       conf.Addrs,
+		Password:    conf.Password,
+		IdleTimeout: time.Second * time.Duration(conf.IdleTimeout),
+	})
+}
@@ -0,0 +1,275 @@
+package interceptor
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	redis "gopkg.in/redis.v5"
+)
+
+type mockRedis struct {
+	lock    sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	calls   map[string]int
+}
+
+func newMockRedis() *mockRedis {
+	return &mockRedis{
+		values:  make(map[string]string),
+		expires: make(map[string]time.Time),
+		calls:   make(map[string]int),
+	}
+}
+
+func (m *mockRedis) Get(key string) *redis.StringCmd {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls["get"]++
+	v, ok := m.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (m *mockRedis) Set(key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values[key] = string(value.([]byte))
+	delete(m.expires, key)
+	if expiration > 0 {
+		m.expires[key] = time.Now().Add(expiration)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (m *mockRedis) Del(keys ...string) *redis.IntCmd {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, key := range keys {
+		delete(m.values, key)
+		delete(m.expires, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func (m *mockRedis) TTL(key string) *redis.DurationCmd {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls["ttl"]++
+	if _, ok := m.values[key]; !ok {
+		return redis.NewDurationResult(-2*time.Second, nil)
+	}
+	expire, ok := m.expires[key]
+	if !ok {
+		return redis.NewDurationResult(-time.Second, nil)
+	}
+	return redis.NewDurationResult(time.Until(expire), nil)
+}
+
+func TestLRUStore(t *testing.T) {
+	store := NewLRUStore(2)
+	_, err := store.Get("a")
+	assert.Equal(t, ErrCacheMiss, err)
+
+	assert.Nil(t, store.Set("a", []byte("1"), 0))
+	assert.Nil(t, store.Set("b", []byte("2"), time.Minute))
+	ttl, err := store.TTL("a")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+	ttl, err = store.TTL("b")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	// a is used recently, so b is evicted
+	b, err := store.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), b)
+	assert.Nil(t, store.Set("c", []byte("3"), time.Minute))
+	_, err = store.Get("b")
+	assert.Equal(t, ErrCacheMiss, err)
+
+	assert.Nil(t, store.Set("c", []byte("4"), time.Millisecond))
+	time.Sleep(time.Millisecond * 5)
+	_, err = store.Get("c")
+	assert.Equal(t, ErrCacheMiss, err)
+	_, err = store.TTL("c")
+	assert.Equal(t, ErrCacheMiss, err)
+
+	assert.Nil(t, store.Delete("a"))
+	assert.Nil(t, store.Delete("a"))
+	_, err = store.Get("a")
+	assert.Equal(t, ErrCacheMiss, err)
+}
+
+// Eval runs getWithTTLScript only.
+func (m *mockRedis) Eval(script string, keys []string, args ...interface{}) *redis.Cmd {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls["eval"]++
+	if script != getWithTTLScript {
+		return redis.NewCmdResult(nil, errors.New("unknown script"))
+	}
+
+	v, ok := m.values[keys[0]]
+	if !ok {
+		return redis.NewCmdResult(nil, redis.Nil)
+	}
+	pttl := int64(-1)
+	if expire, ok := m.expires[keys[0]]; ok {
+		pttl = int64(time.Until(expire) / time.Millisecond)
+	}
+	return redis.NewCmdResult([]interface{}{v, pttl}, nil)
+}
+
+func (m *mockRedis) callsOf(cmd string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.calls[cmd]
+}
+
+func TestRedisStore(t *testing.T) {
+	store := NewRedisStore(newMockRedis())
+	_, err := store.Get("a")
+	assert.Equal(t, ErrCacheMiss, err)
+	_, err = store.TTL("a")
+	assert.Equal(t, ErrCacheMiss, err)
+
+	assert.Nil(t, store.Set("a", []byte("1"), 0))
+	b, err := store.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), b)
+	ttl, err := store.TTL("a")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	b, ttl, err = store.(ttlGetter).GetWithTTL("a")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), b)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	assert.Nil(t, store.Set("a", []byte("1"), time.Minute))
+	ttl, err = store.TTL("a")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+	_, ttl, err = store.(ttlGetter).GetWithTTL("a")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	assert.Nil(t, store.Delete("a"))
+	_, err = store.Get("a")
+	assert.Equal(t, ErrCacheMiss, err)
+	_, _, err = store.(ttlGetter).GetWithTTL("a")
+	assert.Equal(t, ErrCacheMiss, err)
+}
+
+func TestTwoLevelStore(t *testing.T) {
+	local := NewLRUStore(10)
+	client := newMockRedis()
+	remote := NewRedisStore(client)
+	store := NewTwoLevelStore(local, remote, time.Second)
+
+	assert.Nil(t, store.Set("a", []byte("1"), time.Minute))
+	ttl, err := local.TTL("a")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Second)
+	ttl, err = store.TTL("a")
+	assert.Nil(t, err)
+	assert.True(t, ttl > time.Second)
+
+	// read through to the remote, and kept locally no longer than the remote
+	assert.Nil(t, remote.Set("b", []byte("2"), time.Millisecond*500))
+	gets, ttls := client.callsOf("get"), client.callsOf("ttl")
+	b, err := store.Get("b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), b)
+	// in one round trip
+	assert.Equal(t, 1, client.callsOf("eval"))
+	assert.Equal(t, gets, client.callsOf("get"))
+	assert.Equal(t, ttls, client.callsOf("ttl"))
+	ttl, err = local.TTL("b")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Millisecond*500)
+
+	// served locally
+	assert.Nil(t, remote.Delete("b"))
+	b, err = store.Get("b")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), b)
+
+	assert.Nil(t, store.Delete("a"))
+	_, err = local.Get("a")
+	assert.Equal(t, ErrCacheMiss, err)
+	_, err = store.Get("a")
+	assert.Equal(t, ErrCacheMiss, err)
+}
+
+func TestNewCacheStore(t *testing.T) {
+	store, err := NewCacheStore(oconf.RpcCacheRedisConf{Store: CacheStoreLRU, LocalSize: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, store.(*lruStore).size)
+
+	store, err = NewCacheStore(oconf.RpcCacheRedisConf{Store: CacheStoreTwoLevel})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultLocalTTL, store.(twoLevelStore).localTTL)
+
+	_, err = NewCacheStore(oconf.RpcCacheRedisConf{Store: "memcache"})
+	assert.NotNil(t, err)
+	// the unknown stores fail the startup instead of disabling the cache
+	assert.NotNil(t, InitCache(oconf.RpcCacheRedisConf{Enabled: true, Store: "memcache"}))
+}
+
+func TestCacheManagerDo(t *testing.T) {
+	m := &CacheManager{
+		enabled: true,
+		store:   NewLRUStore(10),
+	}
+
+	var (
+		calls int32
+		wg    sync.WaitGroup
+	)
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 10)
+		return &cachedObj{Data: []byte("data")}, nil
+	}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			obj, err := m.do("key", time.Minute, fn)
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("data"), obj.(*cachedObj).Data)
+		}()
+	}
+	wg.Wait()
+	obj, err := m.do("key", time.Minute, fn)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), obj.(*cachedObj).Data)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the errors of the handlers are cached as well
+	_, err = m.do("error", time.Minute, func() (interface{}, error) {
+		return &cachedObj{IvkErr: std.ErrNotFound}, nil
+	})
+	assert.Nil(t, err)
+	obj, err = m.do("error", time.Minute, fn)
+	assert.Nil(t, err)
+	assert.True(t, std.IsIvankaErr(obj.(*cachedObj).IvkErr, std.ErrNotFound))
+
+	failure := errors.New("failure")
+	_, err = m.do("failure", time.Minute, func() (interface{}, error) {
+		return nil, failure
+	})
+	assert.Equal(t, failure, err)
+	_, err = m.store.Get("failure")
+	assert.Equal(t, ErrCacheMiss, err)
+}
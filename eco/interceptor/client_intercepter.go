@@ -2,6 +2,7 @@ package interceptor
 
 import (
 	"context"
+	"errors"
 	"runtime/debug"
 	"time"
 
@@ -23,39 +24,55 @@ func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnarySe
 	resp, err := handler(ctx, req)
 	stop := time.Now()
 	l := stop.Sub(start)
-	logField := oc.LogFields{
-		"type":          "grpcaccess",
-		"remote_ip":     occ.PbMetaGet(occ.Md_CLIENTIP, ctx),
-		"host":          occ.PbMetaGet(occ.Md_Host, ctx),
-		"uri":           occ.PbMetaGet(occ.Md_Uri, ctx),
-		"grpc_method":   info.FullMethod,
-		"app":           oconf.ConfSvcName(),
-		"request_data":  strutil.FromObject(req),
-		"method":        occ.PbMetaGet(occ.Md_Method, ctx),
-		"path":          occ.PbMetaGet(occ.Md_Path, ctx),
-		"route":         occ.PbMetaGet(occ.Md_Route, ctx),
-		"user_agent":    occ.PbMetaGet(occ.Md_UserAgent, ctx),
-		"x_request_id":  occ.PbMetaGet(occ.Md_RequestId, ctx),
-		"latency":       l.Nanoseconds() / 1000000,
-		"latency_human": l.String(),
-		"app_header":    occ.PbMetaGet(occ.Md_APPHEADER, ctx),
-		"version":       occ.PbMetaGet(occ.Md_Version, ctx),
-		"device_id":     occ.PbMetaGet(occ.Md_DEVICEID, ctx),
-		"device_type":   occ.PbMetaGet(occ.Md_DEVICETYPE, ctx),
-		"user_id":       occ.PbMetaGet(occ.Md_USERID, ctx),
-		"bundle_id":     occ.PbMetaGet(occ.Md_Bundle_Id, ctx),
-		"app_type":      occ.PbMetaGet(occ.Md_App_Type, ctx),
-		"client_type":   occ.PbMetaGet(occ.Md_Client_Type, ctx),
-	}
+	logField := accessLogFields(ctx, info.FullMethod)
+	logField["request_data"] = strutil.FromObject(req)
+	logField["latency"] = l.Nanoseconds() / 1000000
+	logField["latency_human"] = l.String()
 	if err != nil {
 		logField["is_error"] = true
 		logField["err_message"] = err.Error()
+		addErrFields(logField, err)
 	}
 	oc.LogUserActivity(logField, "grpcaccess")
 
 	return resp, err
 }
 
+// addErrFields adds the cause and the stack of the Err wrapped by err, which are never sent to the clients.
+func addErrFields(fields oc.LogFields, err error) {
+	var e *oc.Err
+	if !errors.As(err, &e) || e.Unwrap() == nil {
+		return
+	}
+
+	fields["err_cause"] = e.Unwrap().Error()
+	fields["err_stack"] = e.Stack()
+}
+
+func accessLogFields(ctx context.Context, fullMethod string) oc.LogFields {
+	return oc.LogFields{
+		"type":         "grpcaccess",
+		"remote_ip":    occ.PbMetaGet(occ.Md_CLIENTIP, ctx),
+		"host":         occ.PbMetaGet(occ.Md_Host, ctx),
+		"uri":          occ.PbMetaGet(occ.Md_Uri, ctx),
+		"grpc_method":  fullMethod,
+		"app":          oconf.ConfSvcName(),
+		"method":       occ.PbMetaGet(occ.Md_Method, ctx),
+		"path":         occ.PbMetaGet(occ.Md_Path, ctx),
+		"route":        occ.PbMetaGet(occ.Md_Route, ctx),
+		"user_agent":   occ.PbMetaGet(occ.Md_UserAgent, ctx),
+		"x_request_id": occ.PbMetaGet(occ.Md_RequestId, ctx),
+		"app_header":   occ.PbMetaGet(occ.Md_APPHEADER, ctx),
+		"version":      occ.PbMetaGet(occ.Md_Version, ctx),
+		"device_id":    occ.PbMetaGet(occ.Md_DEVICEID, ctx),
+		"device_type":  occ.PbMetaGet(occ.Md_DEVICETYPE, ctx),
+		"user_id":      occ.PbMetaGet(occ.Md_USERID, ctx),
+		"bundle_id":    occ.PbMetaGet(occ.Md_Bundle_Id, ctx),
+		"app_type":     occ.PbMetaGet(occ.Md_App_Type, ctx),
+		"client_type":  occ.PbMetaGet(occ.Md_Client_Type, ctx),
+	}
+}
+
 func RecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -72,7 +89,8 @@ func RecoverInterceptorV2() grpc.UnaryServerInterceptor {
 	return grpc_recovery.UnaryServerInterceptor(
 		grpc_recovery.WithRecoveryHandler(func(p interface{}) (err error) {
 			oc.LogRecover(p)
-			return oc.ErrInternal
+			// outside the error interceptor
+			return toStatusError(oc.ErrInternal)
 		}),
 	)
 }
@@ -87,16 +105,15 @@ func ClientTimeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor
 	}
 }
 
+// ServerTimeoutInterceptor times out the calls in t seconds, DefaultServerTimeout if not positive,
+// see UnaryTimeoutInterceptor.
 func ServerTimeoutInterceptor(t int64) grpc.UnaryServerInterceptor {
+	timeout := time.Duration(t) * time.Second
 	if t <= 0 {
-		t = 5
-	}
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
-		handler grpc.UnaryHandler) (resp interface{}, err error) {
-		ctx, cancel := ShrinkDeadline(ctx, time.Duration(t)*time.Second)
-		defer cancel()
-		return handler(ctx, req)
+		timeout = DefaultServerTimeout
 	}
+
+	return UnaryTimeoutInterceptor(timeout, nil)
 }
 
 func ShrinkDeadline(ctx context.Context, timeout time.Duration) (context.Context, func()) {
@@ -0,0 +1,82 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryErrorInterceptor converts the Errs returned by the handlers to the grpc statuses, see Err.Status.
+func UnaryErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatusError(err)
+}
+
+// StreamErrorInterceptor converts the Errs returned by the handlers to the grpc statuses, see Err.Status.
+func StreamErrorInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	return toStatusError(handler(srv, stream))
+}
+
+// ClientErrorInterceptor rebuilds the Errs from the grpc statuses, so that IsIvankaErr works across the services.
+func ClientErrorInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return fromStatusError(invoker(ctx, method, req, reply, cc, opts...))
+}
+
+// StreamClientErrorInterceptor rebuilds the Errs from the grpc statuses of the streams, see ClientErrorInterceptor.
+func StreamClientErrorInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+	streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, fromStatusError(err)
+	}
+
+	return &monitoredClientStream{
+		ClientStream: stream,
+		wrapErr:      fromStatusError,
+	}, nil
+}
+
+// statusError is the grpc status of an Err, which keeps the Err in the chain
+// for the outer interceptors to log the cause and the stack.
+type statusError struct {
+	err *std.Err
+}
+
+func (e statusError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+func (e statusError) GRPCStatus() *status.Status {
+	return e.err.Status()
+}
+
+func (e statusError) Unwrap() error {
+	return e.err
+}
+
+func toStatusError(err error) error {
+	var e *std.Err
+	if errors.As(err, &e) {
+		return statusError{err: e}
+	}
+
+	return err
+}
+
+func fromStatusError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st == nil {
+		return err
+	}
+	if e, ok := std.ErrFromStatus(st); ok {
+		return e
+	}
+
+	return err
+}
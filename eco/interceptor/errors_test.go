@@ -0,0 +1,121 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorInterceptors(t *testing.T) {
+	errBusiness := &std.Err{Code: 60201, Message: "business"}
+	errPlain := errors.New("plain")
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "not found", err: std.ErrNotFound, code: codes.NotFound},
+		{name: "too many requests", err: std.ErrTooManyRequests, code: codes.ResourceExhausted},
+		{name: "internal", err: std.ErrDatabase, code: codes.Internal},
+		{name: "params", err: std.ErrParams, code: codes.InvalidArgument},
+		{name: "business", err: errBusiness, code: codes.Unknown},
+		{name: "plain", err: errPlain, code: codes.Unknown},
+		{name: "status", err: status.Error(codes.Aborted, "aborted"), code: codes.Aborted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := UnaryErrorInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return nil, test.err
+				})
+			assert.Equal(t, test.code, status.Code(err))
+
+			// the old clients parse the message
+			if e, ok := test.err.(*std.Err); ok {
+				assert.Equal(t, e.Error(), status.Convert(err).Message())
+			}
+
+			err = ClientErrorInterceptor(context.Background(), "/pkg.Svc/Get", nil, nil, nil,
+				func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+					opts ...grpc.CallOption) error {
+					return err
+				})
+			if e, ok := test.err.(*std.Err); ok {
+				assert.True(t, std.IsIvankaErr(err, e))
+				assert.Equal(t, e.Message, err.(*std.Err).Message)
+			} else {
+				assert.Equal(t, test.code, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestStreamClientErrorInterceptor(t *testing.T) {
+	stream, err := StreamClientErrorInterceptor(context.Background(), &grpc.StreamDesc{}, nil, "/pkg.Svc/Watch",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+			opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return nil, std.ErrNotFound.Status().Err()
+		})
+	assert.Nil(t, stream)
+	assert.True(t, std.IsIvankaErr(err, std.ErrNotFound))
+
+	err = StreamErrorInterceptor(nil, nil, &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			return std.ErrTooManyRequests
+		})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.True(t, std.IsIvankaErr(std.ErrFromGoErr(err), std.ErrTooManyRequests))
+}
+
+func TestWrappedErrors(t *testing.T) {
+	cause := fmt.Errorf("query users: %w", gorm.ErrRecordNotFound)
+	wrapped := fmt.Errorf("get user: %w", std.Wrap(cause, std.ErrDatabase))
+
+	assert.Nil(t, std.Wrap(nil, std.ErrDatabase))
+	assert.True(t, std.IsIvankaErr(wrapped, std.ErrDatabase))
+	assert.False(t, std.IsIvankaErr(wrapped, std.ErrNotFound))
+	assert.True(t, errors.Is(wrapped, gorm.ErrRecordNotFound))
+
+	var e *std.Err
+	assert.True(t, errors.As(wrapped, &e))
+	assert.Equal(t, cause, e.Unwrap())
+	assert.Contains(t, e.Stack(), "TestWrappedErrors")
+	assert.Equal(t, std.ErrDatabase.Error(), e.Error())
+	assert.Equal(t, e, std.ErrFromGoErr(wrapped))
+
+	// the sentinel errors of the other libraries are mapped by errors.Is
+	e = std.ErrFromGoErr(cause)
+	assert.Equal(t, std.ErrNotFound.Code, e.Code)
+	assert.Equal(t, cause, e.Unwrap())
+	other := errors.New("other")
+	std.RegisterErrMapping(other, std.ErrNoData)
+	assert.True(t, std.IsIvankaErr(std.ErrFromGoErr(fmt.Errorf("wrapped: %w", other)), std.ErrNoData))
+
+	// the cause and the stack are logged, but never sent to the clients
+	_, err := UnaryErrorInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, wrapped
+		})
+	st, _ := status.FromError(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.NotContains(t, st.Message(), "query users")
+	assert.NotContains(t, fmt.Sprint(st.Details()), "query users")
+	assert.True(t, std.IsIvankaErr(err, std.ErrDatabase))
+
+	fields := std.LogFields{}
+	addErrFields(fields, err)
+	assert.Equal(t, cause.Error(), fields["err_cause"])
+	assert.Contains(t, fields["err_stack"], "TestWrappedErrors")
+	fields = std.LogFields{}
+	addErrFields(fields, std.ErrDatabase)
+	assert.Empty(t, fields)
+}
@@ -0,0 +1,182 @@
+package interceptor
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/log"
+	ecodes "github.com/wednesdaysunny/onerpc/eco/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// HedgeAttemptHeader carries the attempt number of a hedged call, the first call doesn't have it
+	HedgeAttemptHeader = "x-hedge-attempt"
+
+	hedgeResultSent = "sent"
+	hedgeResultWon  = "won"
+)
+
+type (
+	HedgingPolicy struct {
+		// how long to wait for the previous attempt before sending the next one
+		Delay time.Duration
+		// how many duplicates can be sent at most, besides the first call
+		MaxHedges int
+	}
+
+	// HedgeInvoker sends an attempt of a hedged call, attempt is 0 for the first call,
+	// and reply is the own one of the attempt.
+	HedgeInvoker func(ctx context.Context, attempt int, reply interface{}) error
+
+	hedgeResult struct {
+		attempt int
+		reply   proto.Message
+		err     error
+	}
+
+	hedgeAttemptKey struct{}
+)
+
+// HedgeAttemptFromContext returns the attempt number of the hedged call, 0 for the first call.
+func HedgeAttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(hedgeAttemptKey{}).(int)
+	return attempt
+}
+
+// HedgingPolicyOf returns the policy of the full method in policies, or the one of AnyMethod.
+func HedgingPolicyOf(policies map[string]HedgingPolicy, method string) (HedgingPolicy, bool) {
+	policy, ok := policies[method]
+	if !ok {
+		policy, ok = policies[AnyMethod]
+	}
+
+	return policy, ok && policy.MaxHedges > 0
+}
+
+// HedgingInterceptor hedges the calls on the connection of the call, see Hedge. All the attempts go through
+// the same connection, and its balancer picks an endpoint for each like for any other call, so a duplicate
+// goes to another endpoint only if the balancer picks one. The clients by NewClient hedge over the connections
+// of their pool instead. Only set it on the idempotent methods, and not together with the retry on the same method.
+func HedgingInterceptor(target string, policies map[string]HedgingPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := HedgingPolicyOf(policies, method)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		return Hedge(ctx, target, method, policy, reply, func(ctx context.Context, attempt int, reply interface{}) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	}
+}
+
+// Hedge sends the call by invoke, and a duplicate each time the previous attempt hasn't answered within
+// the delay of policy, takes the first success and cancels the rest. The duplicates carry HedgeAttemptHeader,
+// and their attempt numbers in the context, see HedgeAttemptFromContext. Only the first attempt is sent
+// if reply isn't a proto.Message.
+func Hedge(ctx context.Context, target, method string, policy HedgingPolicy, reply interface{},
+	invoke HedgeInvoker) error {
+	msg, ok := reply.(proto.Message)
+	if !ok || policy.MaxHedges <= 0 {
+		return invoke(ctx, 0, reply)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// each attempt has its own reply, otherwise they would write into the same one concurrently
+	results := make(chan hedgeResult, policy.MaxHedges+1)
+	launch := func(attempt int) {
+		attemptReply := reflect.New(reflect.TypeOf(msg).Elem()).Interface().(proto.Message)
+		attemptCtx := ctx
+		if attempt > 0 {
+			attemptCtx = context.WithValue(ctx, hedgeAttemptKey{}, attempt)
+			attemptCtx = metadata.AppendToOutgoingContext(attemptCtx, HedgeAttemptHeader, strconv.Itoa(attempt))
+			observeHedge(target, method, hedgeResultSent)
+		}
+
+		go func() {
+			err := invoke(attemptCtx, attempt, attemptReply)
+			results <- hedgeResult{
+				attempt: attempt,
+				reply:   attemptReply,
+				err:     err,
+			}
+		}()
+	}
+
+	timer := time.NewTimer(policy.Delay)
+	defer func() {
+		timer.Stop()
+	}()
+
+	var (
+		sent    = 1
+		pending = 1
+		lastErr error
+	)
+	launch(0)
+	for {
+		select {
+		case <-timer.C:
+			if sent <= policy.MaxHedges {
+				launch(sent)
+				sent++
+				pending++
+				timer.Reset(policy.Delay)
+			}
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				msg.Reset()
+				proto.Merge(msg, result.reply)
+				if result.attempt > 0 {
+					observeHedge(target, method, hedgeResultWon)
+				}
+				return nil
+			}
+			// the errors from the business logic won't be different on another endpoint
+			if ecodes.Acceptable(result.err) {
+				return result.err
+			}
+
+			lastErr = result.err
+			if sent <= policy.MaxHedges {
+				// no need to wait for the delay, the previous attempt already failed
+				launch(sent)
+				sent++
+				pending++
+				timer.Stop()
+				timer = time.NewTimer(policy.Delay)
+			} else if pending == 0 {
+				return lastErr
+			}
+		}
+	}
+}
+
+func observeHedge(target, method, result string) {
+	if !isPrometheusEnabled() {
+		return
+	}
+
+	labels, lerr := HedgeLabels.CreatePromLabels(map[string]string{
+		LabelNamespace:   "one",
+		LabelSourceApp:   svcName,
+		LabelTarget:      target,
+		LabelMethod:      method,
+		LabelHedgeResult: result,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+
+	GetPromMonitor().IncrHedgeTotal(labels)
+}
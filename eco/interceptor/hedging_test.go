@@ -0,0 +1,110 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestHedgingInterceptor(t *testing.T) {
+	var (
+		calls       int32
+		interceptor = HedgingInterceptor("hedging", map[string]HedgingPolicy{
+			AnyMethod: {Delay: time.Millisecond * 10, MaxHedges: 2},
+		})
+		reply wrappers.StringValue
+	)
+	err := interceptor(context.Background(), "/pkg.Svc/Get", nil, &reply, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			atomic.AddInt32(&calls, 1)
+			attempt := HedgeAttemptFromContext(ctx)
+			// not counted as the retries
+			assert.Equal(t, 0, AttemptFromContext(ctx))
+			if attempt == 0 {
+				// the first attempt is slow, and is cancelled once the hedge wins
+				<-ctx.Done()
+				return status.Error(codes.Canceled, "cancelled")
+			}
+
+			reply.(*wrappers.StringValue).Value = "hedge"
+			return nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "hedge", reply.Value)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHedgingInterceptorFailures(t *testing.T) {
+	var (
+		calls       int32
+		interceptor = HedgingInterceptor("hedging", map[string]HedgingPolicy{
+			AnyMethod: {Delay: time.Second, MaxHedges: 2},
+		})
+		reply wrappers.StringValue
+	)
+	err := interceptor(context.Background(), "/pkg.Svc/Get", nil, &reply, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			atomic.AddInt32(&calls, 1)
+			return status.Error(codes.Unavailable, "unavailable")
+		})
+	// the failed attempts trigger the hedges without waiting for the delay
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	err = interceptor(context.Background(), "/pkg.Svc/Get", nil, &reply, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			atomic.AddInt32(&calls, 1)
+			return status.Error(codes.NotFound, "not found")
+		})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHedgingInterceptorAttempts(t *testing.T) {
+	var (
+		lock        sync.Mutex
+		attempts    []string
+		conns       = make(map[*grpc.ClientConn]bool)
+		cc          = new(grpc.ClientConn)
+		interceptor = HedgingInterceptor("hedging", map[string]HedgingPolicy{
+			AnyMethod: {Delay: time.Millisecond * 5, MaxHedges: 2},
+		})
+		reply wrappers.StringValue
+	)
+	err := interceptor(context.Background(), "/pkg.Svc/Get", nil, &reply, cc,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			lock.Lock()
+			attempts = append(attempts, strings.Join(md.Get(HedgeAttemptHeader), ","))
+			conns[cc] = true
+			last := len(attempts) == 3
+			lock.Unlock()
+			if !last {
+				<-ctx.Done()
+				return status.Error(codes.Canceled, "cancelled")
+			}
+
+			reply.(*wrappers.StringValue).Value = "hedge"
+			return nil
+		})
+	assert.Nil(t, err)
+	assert.Equal(t, "hedge", reply.Value)
+	// the attempts are separate calls on the connection of the interceptor, told apart by the header only
+	assert.Equal(t, []string{"", "1", "2"}, attempts)
+	assert.Equal(t, map[*grpc.ClientConn]bool{cc: true}, conns)
+}
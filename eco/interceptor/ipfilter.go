@@ -0,0 +1,90 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	stdc "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	"github.com/wednesdaysunny/onerpc/eco/ipfilter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// UnaryIPFilterInterceptor rejects the calls from the banned ips with PermissionDenied, carrying ErrBanIp,
+// except the health checks.
+func UnaryIPFilterInterceptor(filter *ipfilter.Filter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkIP(ctx, info.FullMethod, filter); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamIPFilterInterceptor rejects the streams from the banned ips with PermissionDenied, carrying ErrBanIp,
+// except the health checks.
+func StreamIPFilterInterceptor(filter *ipfilter.Filter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		if err := checkIP(stream.Context(), info.FullMethod, filter); err != nil {
+			return err
+		}
+
+		return handler(srv, stream)
+	}
+}
+
+func checkIP(ctx context.Context, method string, filter *ipfilter.Filter) error {
+	// the health probes come from the kubelet or the load balancers, rarely in the allow list
+	if strings.HasPrefix(method, healthServicePrefix) || filter.Allow(callerIPs(ctx)) {
+		return nil
+	}
+
+	observeIPBanned(method)
+	return std.ErrBanIp.Status().Err()
+}
+
+func observeIPBanned(method string) {
+	if !isPrometheusEnabled() {
+		return
+	}
+
+	labels, lerr := IPBannedLabels.CreatePromLabels(map[string]string{
+		LabelNamespace: "one",
+		LabelSourceApp: svcName,
+		LabelMethod:    method,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+
+	GetPromMonitor().IncrIPBanned(labels)
+}
+
+// callerIPs returns the ip of the peer, and the client ip forwarded by the peer, like the gateway, if any.
+func callerIPs(ctx context.Context) (peerIP, forwarded net.IP) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerIP = ipfilter.ParseIP(p.Addr.String())
+	}
+	if ip := stdc.PbMetaGet(stdc.Md_CLIENTIP, ctx); len(ip) > 0 {
+		forwarded = ipfilter.ParseIP(ip)
+	}
+
+	return peerIP, forwarded
+}
+
+// clientIp returns the ip of the client, the forwarded one only from the trusted proxies, see ipfilter.ClientIP.
+func clientIp(ctx context.Context, trusted []*net.IPNet) string {
+	peerIP, forwarded := callerIPs(ctx)
+	if ip := ipfilter.ClientIP(peerIP, forwarded, trusted); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,41 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"github.com/wednesdaysunny/onerpc/eco/ipfilter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryIPFilterInterceptor(t *testing.T) {
+	filter, err := ipfilter.NewFilter(oconf.IPFilterConf{Allow: []string{"10.0.0.0/8"}}, nil)
+	assert.Nil(t, err)
+	defer filter.Stop()
+
+	interceptor := UnaryIPFilterInterceptor(filter)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(ip, method string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234},
+		})
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.Nil(t, call("10.0.0.1", "/pkg.Svc/Get"))
+	err = call("192.168.0.1", "/pkg.Svc/Get")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, std.ErrBanIp.Code, std.ErrFromGoErr(err).Code)
+	// the health probes are never filtered
+	assert.Nil(t, call("192.168.0.1", "/grpc.health.v1.Health/Check"))
+}
@@ -84,6 +84,12 @@ func ClientInterceptor() grpc.UnaryClientInterceptor {
 			ext.SpanKindRPCClient,
 		)
 		defer span.Finish()
+		if attempt := AttemptFromContext(ctx); attempt > 0 {
+			span.SetTag("rpc.retry_attempt", attempt)
+		}
+		if attempt := HedgeAttemptFromContext(ctx); attempt > 0 {
+			span.SetTag("rpc.hedge_attempt", attempt)
+		}
 
 		md, ok := metadata.FromOutgoingContext(ctx)
 		if !ok {
@@ -0,0 +1,151 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	stdc "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// the language of the built-in messages of the Errs
+const defaultLanguage = stdc.LanguageZh
+
+// UnaryLocalizeInterceptor localizes the messages of the Errs returned, by the language of the caller
+// and the catalog loaded by std.LoadMessages, the Errs in grpc statuses are localized as well.
+func UnaryLocalizeInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		err = localizeError(err, languageOf(ctx))
+	}
+
+	return resp, err
+}
+
+// StreamLocalizeInterceptor localizes the messages of the Errs returned, see UnaryLocalizeInterceptor.
+func StreamLocalizeInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	err := handler(srv, stream)
+	if err != nil {
+		err = localizeError(err, languageOf(stream.Context()))
+	}
+
+	return err
+}
+
+func localizeError(err error, language string) error {
+	if len(language) == 0 {
+		return err
+	}
+
+	var e *std.Err
+	if errors.As(err, &e) {
+		localized := e.Localize(language)
+		if localized == e {
+			return err
+		}
+		if _, ok := err.(statusError); ok {
+			return statusError{err: localized}
+		}
+		return localized
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	e, ok = std.ErrFromStatus(st)
+	if !ok {
+		return err
+	}
+	localized := e.Localize(language)
+	if localized == e {
+		return err
+	}
+
+	return localizedStatus(st, localized).Err()
+}
+
+// localizedStatus replaces the message and the ErrorInfo of st by the ones of e, the other details,
+// like the BadRequest of the validation, are kept.
+func localizedStatus(st *status.Status, e *std.Err) *status.Status {
+	replaced := e.Status().Proto()
+	p := st.Proto()
+	p.Message = replaced.GetMessage()
+	for i, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == std.ErrorDomain &&
+			len(replaced.GetDetails()) > 0 {
+			p.Details[i] = replaced.GetDetails()[0]
+		}
+	}
+
+	return status.FromProto(p)
+}
+
+// languageOf returns the language of the caller, by the app header, or the most preferred one
+// in the catalog by the Accept-Language, empty if none is found.
+func languageOf(ctx context.Context) string {
+	if language := stdc.PbMetaGet(stdc.MdAppLanguage, ctx); len(language) > 0 {
+		return baseLanguage(language)
+	}
+
+	return preferredLanguage(stdc.PbMetaGet(stdc.MdAcceptLanguage, ctx))
+}
+
+// preferredLanguage returns the language of the highest quality in the catalog, like en for en-US,en;q=0.9.
+func preferredLanguage(acceptLanguage string) string {
+	type candidate struct {
+		language string
+		quality  float64
+	}
+
+	var candidates []candidate
+	for _, item := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(item), ";")
+		language := baseLanguage(fields[0])
+		if len(language) == 0 || language == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			candidates = append(candidates, candidate{language: language, quality: quality})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	for _, item := range candidates {
+		if item.language == defaultLanguage || std.HasLanguage(item.language) {
+			return item.language
+		}
+	}
+
+	return ""
+}
+
+// baseLanguage returns the language without the region, like zh for zh-CN or zh_CN.
+func baseLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if pos := strings.IndexAny(language, "-_"); pos >= 0 {
+		language = language[:pos]
+	}
+
+	return language
+}
@@ -0,0 +1,122 @@
+package interceptor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	stdc "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func loadTestMessages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "messages")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "messages.yaml")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`en:
+  onerpc:
+    40400: The resource is not found
+    42900: Too many requests, please try again later
+    50004: Invalid parameters
+  other:
+    50000: The internal error of the other domain
+`), 0644))
+	assert.Nil(t, std.LoadMessages(file))
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	loadTestMessages(t)
+	defer std.SetMessages(nil)
+
+	tests := []struct {
+		accept   string
+		language string
+	}{
+		{accept: "", language: ""},
+		{accept: "en-US,en;q=0.9", language: stdc.LanguageEn},
+		{accept: "fr-FR,en;q=0.8,zh;q=0.9", language: stdc.LanguageZh},
+		{accept: "fr, *;q=0.5", language: ""},
+		{accept: "zh_CN;q=0.1, EN;q=0.5", language: stdc.LanguageEn},
+		{accept: "en;q=0", language: ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.language, preferredLanguage(test.accept), test.accept)
+	}
+}
+
+func TestLocalizeInterceptors(t *testing.T) {
+	loadTestMessages(t)
+	defer std.SetMessages(nil)
+
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		err     error
+		message string
+	}{
+		{name: "err", md: metadata.Pairs(stdc.MdAcceptLanguage, "en-US"), err: std.ErrNotFound,
+			message: "The resource is not found"},
+		{name: "status", md: metadata.Pairs(stdc.MdAcceptLanguage, "en"), err: std.ErrTooManyRequests.Status().Err(),
+			message: "Too many requests, please try again later"},
+		{name: "app header", md: metadata.Pairs(stdc.MdAcceptLanguage, "zh", stdc.MdAppLanguage, "en"), err: std.ErrNotFound,
+			message: "The resource is not found"},
+		{name: "default language", md: metadata.Pairs(stdc.MdAcceptLanguage, "zh-CN"), err: std.ErrNotFound,
+			message: std.ErrNotFound.Message},
+		{name: "missing message", md: metadata.Pairs(stdc.MdAcceptLanguage, "en"), err: std.ErrDatabase,
+			message: std.ErrDatabase.Message},
+		{name: "no language", err: std.ErrNotFound, message: std.ErrNotFound.Message},
+		{name: "other domain", md: metadata.Pairs(stdc.MdAcceptLanguage, "en"), err: std.ErrInternal,
+			message: std.ErrInternal.Message},
+		{name: "unknown domain", md: metadata.Pairs(stdc.MdAcceptLanguage, "en"),
+			err: std.ErrFromString(std.ErrNotFound.Error()), message: "The resource is not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), test.md)
+			_, err := UnaryLocalizeInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return nil, test.err
+				})
+			e := std.ErrFromGoErr(err)
+			assert.Equal(t, std.ErrFromGoErr(test.err).Code, e.Code)
+			assert.Equal(t, test.message, e.Message)
+			assert.Equal(t, status.Code(test.err), status.Code(err))
+		})
+	}
+
+	err := StreamLocalizeInterceptor(nil, &mockServerStream{
+		ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(stdc.MdAcceptLanguage, "en")),
+	}, &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"}, func(srv interface{}, stream grpc.ServerStream) error {
+		return status.Error(codes.Aborted, "aborted")
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestLocalizeValidation(t *testing.T) {
+	loadTestMessages(t)
+	defer std.SetMessages(nil)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(stdc.MdAcceptLanguage, "en"))
+	req := &mockRequest{err: mockValidationError{field: "Id", reason: "value must be greater than 0"}}
+	_, err := UnaryLocalizeInterceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return UnaryValidateInterceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "ok", nil
+		})
+	})
+
+	// localized, with the field violations kept
+	assert.Equal(t, "Invalid parameters", std.ErrFromGoErr(err).Message)
+	assert.Equal(t, map[string]string{"Id": "value must be greater than 0"}, violationsOf(t, err))
+}
@@ -25,6 +25,14 @@ const (
 	MetricRequestDuration  = "request_duration"
 	MetricResponseTotal    = "response_total"
 	MetricResponseDuration = "response_duration"
+	MetricBreakerDropRatio = "breaker_drop_ratio"
+	MetricBreakerRejected  = "breaker_rejected_total"
+	MetricRetryTotal       = "retry_total"
+	MetricHedgeTotal       = "hedge_total"
+	MetricSheddingTotal    = "shedding_total"
+	MetricSheddingCpu      = "shedding_cpu_usage"
+	MetricIPBanned         = "ip_banned_total"
+	MetricAuthRejected     = "auth_rejected_total"
 
 	LabelDestinationApp     = "dst_app"
 	LabelDestinationVersion = "dst_version"
@@ -38,6 +46,11 @@ const (
 	LabelHostname           = "hostname"
 	LabelNamespace          = "namespace"
 	LabelResponseStatus     = "response_status"
+	LabelTarget             = "target"
+	LabelRetryResult        = "retry_result"
+	LabelHedgeResult        = "hedge_result"
+	LabelSheddingResult     = "shedding_result"
+	LabelAuthReason         = "auth_reason"
 
 	GrpcProtocol = "grpc"
 	HttpProtocol = "http"
@@ -62,6 +75,14 @@ type PromMonitor struct {
 	RequestDuration  *prometheus.HistogramVec
 	ResponseTotal    *prometheus.CounterVec
 	ResponseDuration *prometheus.HistogramVec
+	BreakerDropRatio *prometheus.GaugeVec
+	BreakerRejected  *prometheus.CounterVec
+	RetryTotal       *prometheus.CounterVec
+	HedgeTotal       *prometheus.CounterVec
+	SheddingTotal    *prometheus.CounterVec
+	SheddingCpu      *prometheus.GaugeVec
+	IPBanned         *prometheus.CounterVec
+	AuthRejected     *prometheus.CounterVec
 	Collectors       []MetricCollector
 	Registry         *prometheus.Registry
 	Lock             sync.Mutex
@@ -112,6 +133,41 @@ func (p *PromMonitor) IncrRequestTotal(labels prometheus.Labels) {
 	p.RequestTotal.With(labels).Inc()
 }
 
+func (p *PromMonitor) SetBreakerDropRatio(labels prometheus.Labels, ratio float64) {
+	p.BreakerDropRatio.With(labels).Set(ratio)
+}
+
+func (p *PromMonitor) IncrBreakerRejected(labels prometheus.Labels) {
+	p.BreakerRejected.With(labels).Inc()
+}
+
+func (p *PromMonitor) IncrRetryTotal(labels prometheus.Labels) {
+	p.RetryTotal.With(labels).Inc()
+}
+
+func (p *PromMonitor) IncrHedgeTotal(labels prometheus.Labels) {
+	p.HedgeTotal.With(labels).Inc()
+}
+
+func (p *PromMonitor) IncrSheddingTotal(labels prometheus.Labels) {
+	p.SheddingTotal.With(labels).Inc()
+}
+
+func (p *PromMonitor) SetSheddingCpu(labels prometheus.Labels, usage float64) {
+	p.SheddingCpu.With(labels).Set(usage)
+}
+
+func (p *PromMonitor) IncrIPBanned(labels prometheus.Labels) {
+	p.IPBanned.With(labels).Inc()
+}
+
+func (p *PromMonitor) IncrAuthRejected(labels prometheus.Labels) {
+	p.AuthRejected.With(labels).Inc()
+}
+
+// StartExporter registers the collectors, the metrics are served by MetricsHandler on the admin server,
+// the rpc servers start it, and the processes with only the clients start it by onerpc.StartAdmin,
+// instead of the exporter on :9095 before.
 func (p *PromMonitor) StartExporter() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -122,12 +178,15 @@ func (p *PromMonitor) StartExporter() {
 	for _, v := range p.Collectors {
 		p.Registry.MustRegister(v.Collector)
 	}
-	go func() {
-		prometheusExporterAddr := ":9095"
-		fmt.Println("prometheus exporter listen", prometheusExporterAddr)
-		http.Handle("/metrics", promhttp.HandlerFor(p.Registry, promhttp.HandlerOpts{}))
-		log.Fatal(http.ListenAndServe(prometheusExporterAddr, nil))
-	}()
+}
+
+// MetricsHandler serves the metrics of the monitor, or the ones of the default registry if prometheus is disabled.
+func MetricsHandler() http.Handler {
+	if !isPrometheusEnabled() {
+		return promhttp.Handler()
+	}
+
+	return promhttp.HandlerFor(GetPromMonitor().Registry, promhttp.HandlerOpts{})
 }
 
 type MetricLabels struct {
@@ -181,6 +240,13 @@ var (
 	RequestTotalLabels     = NewMetricLabels()
 	ResponseDurationLabels = NewMetricLabels()
 	ResponseTotalLabels    = NewMetricLabels()
+	BreakerLabels          = NewMetricLabels()
+	RetryLabels            = NewMetricLabels()
+	HedgeLabels            = NewMetricLabels()
+	SheddingLabels         = NewMetricLabels()
+	SheddingCpuLabels      = NewMetricLabels()
+	IPBannedLabels         = NewMetricLabels()
+	AuthRejectedLabels     = NewMetricLabels()
 )
 
 func NewPromMonitor() *PromMonitor {
@@ -214,10 +280,64 @@ func NewPromMonitor() *PromMonitor {
 		Help: "The grpc response total",
 	}, ResponseTotalLabels.GetLabels())
 
+	BreakerLabels.SetLabels([]string{LabelNamespace, LabelSourceApp, LabelTarget, LabelMethod}...)
+	prom.BreakerDropRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: MetricBreakerDropRatio,
+		Help: "The probability that the client breaker drops a request.",
+	}, BreakerLabels.GetLabels())
+	prom.BreakerRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricBreakerRejected,
+		Help: "The grpc requests rejected by the client breaker",
+	}, BreakerLabels.GetLabels())
+
+	RetryLabels.SetLabels([]string{LabelNamespace, LabelSourceApp, LabelTarget, LabelMethod, LabelResponseStatus, LabelRetryResult}...)
+	prom.RetryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricRetryTotal,
+		Help: "The grpc request retries, throttled ones included",
+	}, RetryLabels.GetLabels())
+
+	HedgeLabels.SetLabels([]string{LabelNamespace, LabelSourceApp, LabelTarget, LabelMethod, LabelHedgeResult}...)
+	prom.HedgeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricHedgeTotal,
+		Help: "The hedged grpc requests sent, and the ones that won",
+	}, HedgeLabels.GetLabels())
+
+	SheddingLabels.SetLabels([]string{LabelNamespace, LabelSourceApp, LabelMethod, LabelSheddingResult}...)
+	prom.SheddingTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricSheddingTotal,
+		Help: "The grpc requests passed or dropped by the server load shedder",
+	}, SheddingLabels.GetLabels())
+
+	SheddingCpuLabels.SetLabels([]string{LabelNamespace, LabelSourceApp}...)
+	prom.SheddingCpu = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: MetricSheddingCpu,
+		Help: "The cpu usage in millicpu seen by the server load shedder.",
+	}, SheddingCpuLabels.GetLabels())
+
+	IPBannedLabels.SetLabels([]string{LabelNamespace, LabelSourceApp, LabelMethod}...)
+	prom.IPBanned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricIPBanned,
+		Help: "The grpc requests rejected by the ip filter",
+	}, IPBannedLabels.GetLabels())
+
+	AuthRejectedLabels.SetLabels([]string{LabelNamespace, LabelSourceApp, LabelMethod, LabelApp, LabelAuthReason}...)
+	prom.AuthRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: MetricAuthRejected,
+		Help: "The grpc requests failing the app authentication, allowed ones in non-strict mode included",
+	}, AuthRejectedLabels.GetLabels())
+
 	prom.addCollector(MetricCollector{prom.RequestTotal, fmt.Sprintf("%s:%s", svcName, MetricRequestTotal)})
 	prom.addCollector(MetricCollector{prom.RequestDuration, fmt.Sprintf("%s:%s", svcName, MetricRequestDuration)})
 	prom.addCollector(MetricCollector{prom.ResponseTotal, fmt.Sprintf("%s:%s", svcName, MetricResponseTotal)})
 	prom.addCollector(MetricCollector{prom.ResponseDuration, fmt.Sprintf("%s:%s", svcName, MetricResponseDuration)})
+	prom.addCollector(MetricCollector{prom.BreakerDropRatio, fmt.Sprintf("%s:%s", svcName, MetricBreakerDropRatio)})
+	prom.addCollector(MetricCollector{prom.BreakerRejected, fmt.Sprintf("%s:%s", svcName, MetricBreakerRejected)})
+	prom.addCollector(MetricCollector{prom.RetryTotal, fmt.Sprintf("%s:%s", svcName, MetricRetryTotal)})
+	prom.addCollector(MetricCollector{prom.HedgeTotal, fmt.Sprintf("%s:%s", svcName, MetricHedgeTotal)})
+	prom.addCollector(MetricCollector{prom.SheddingTotal, fmt.Sprintf("%s:%s", svcName, MetricSheddingTotal)})
+	prom.addCollector(MetricCollector{prom.SheddingCpu, fmt.Sprintf("%s:%s", svcName, MetricSheddingCpu)})
+	prom.addCollector(MetricCollector{prom.IPBanned, fmt.Sprintf("%s:%s", svcName, MetricIPBanned)})
+	prom.addCollector(MetricCollector{prom.AuthRejected, fmt.Sprintf("%s:%s", svcName, MetricAuthRejected)})
 
 	prom.StartExporter()
 
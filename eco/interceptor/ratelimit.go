@@ -0,0 +1,162 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	stdc "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	onet "github.com/wednesdaysunny/onerpc/eco/inter/toolkit/net"
+	"github.com/wednesdaysunny/onerpc/eco/limit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/redis.v5"
+)
+
+const (
+	RateLimitByApp  = "app"
+	RateLimitByUser = "user"
+	RateLimitByIp   = "ip"
+
+	RateLimitLocal = "local"
+	RateLimitRedis = "redis"
+)
+
+type (
+	// RateLimitRule limits the calls of Method, or all the methods together if AnyMethod,
+	// per caller keyed By app, user or ip. The calls without the key, like the anonymous ones
+	// limited by user, are not limited by the rule.
+	RateLimitRule struct {
+		Method  string
+		By      string
+		Limiter limit.Limiter
+		// the peers whose forwarded client ip is trusted, for By ip, see ipfilter.ClientIP
+		TrustedProxies []*net.IPNet
+	}
+)
+
+// RateLimitRulesFromConf creates the rules, client is required for the redis store, and the limits
+// by ip take the client ips forwarded by trustedProxies only.
+func RateLimitRulesFromConf(confs []oconf.RateLimitConf, client *redis.Client,
+	trustedProxies []string) ([]RateLimitRule, error) {
+	trusted, err := onet.ParseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []RateLimitRule
+	for _, c := range confs {
+		if len(c.Method) == 0 || c.Rate <= 0 {
+			return nil, fmt.Errorf("rate limit: method and a positive rate required, got %+v", c)
+		}
+
+		rule := RateLimitRule{
+			Method:         c.Method,
+			By:             c.By,
+			TrustedProxies: trusted,
+		}
+		if len(rule.By) == 0 {
+			rule.By = RateLimitByApp
+		}
+		if rule.By != RateLimitByApp && rule.By != RateLimitByUser && rule.By != RateLimitByIp {
+			return nil, fmt.Errorf("rate limit: unknown caller key %q of %s", c.By, c.Method)
+		}
+
+		period := c.Period
+		if period <= 0 {
+			period = 1
+		}
+		switch c.Store {
+		case "", RateLimitLocal:
+			rule.Limiter = limit.NewTokenLimiter(float64(c.Rate)/float64(period), c.Burst)
+		case RateLimitRedis:
+			if client == nil {
+				return nil, fmt.Errorf("rate limit: redis not connected for %s", c.Method)
+			}
+			rule.Limiter = limit.NewWindowLimiter(client, c.Rate, time.Duration(period)*time.Second)
+		default:
+			return nil, fmt.Errorf("rate limit: unknown store %q of %s", c.Store, c.Method)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// UnaryRateLimitInterceptor rejects the calls over the limits with ResourceExhausted, carrying ErrTooManyRequests.
+func UnaryRateLimitInterceptor(rules []RateLimitRule) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkRateLimits(ctx, info.FullMethod, rules); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimitInterceptor rejects the streams over the limits with ResourceExhausted, carrying ErrTooManyRequests.
+func StreamRateLimitInterceptor(rules []RateLimitRule) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		if err := checkRateLimits(stream.Context(), info.FullMethod, rules); err != nil {
+			return err
+		}
+
+		return handler(srv, stream)
+	}
+}
+
+func checkRateLimits(ctx context.Context, method string, rules []RateLimitRule) error {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if rule.Method != AnyMethod && rule.Method != method {
+			continue
+		}
+
+		caller := rateLimitCaller(ctx, rule)
+		if len(caller) == 0 {
+			continue
+		}
+
+		allowed, err := rule.Limiter.Allow(strings.Join([]string{rule.Method, rule.By, caller}, ":"))
+		if err != nil {
+			// let the calls go if the limiter is broken, like redis is down
+			std.LogErrorc("ratelimit", err, fmt.Sprintf("fail to check rate limit of %s", method))
+			continue
+		}
+		if !allowed {
+			return std.ErrTooManyRequests.Status().Err()
+		}
+	}
+
+	return nil
+}
+
+func rateLimitCaller(ctx context.Context, rule RateLimitRule) string {
+	switch rule.By {
+	case RateLimitByApp:
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vals := md.Get(LabelApp); len(vals) > 0 {
+				return vals[0]
+			}
+		}
+	case RateLimitByUser:
+		if uid := stdc.PbGetUser(ctx); uid > 0 {
+			return strconv.FormatInt(uid, 10)
+		}
+	case RateLimitByIp:
+		return clientIp(ctx, rule.TrustedProxies)
+	}
+
+	return ""
+}
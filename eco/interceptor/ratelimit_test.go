@@ -0,0 +1,92 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	stdc "github.com/wednesdaysunny/onerpc/eco/inter/common"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimitRulesFromConf(t *testing.T) {
+	tests := []struct {
+		name string
+		conf oconf.RateLimitConf
+		ok   bool
+	}{
+		{name: "local", conf: oconf.RateLimitConf{Method: AnyMethod, Rate: 10}, ok: true},
+		{name: "no rate", conf: oconf.RateLimitConf{Method: AnyMethod}},
+		{name: "unknown key", conf: oconf.RateLimitConf{Method: AnyMethod, Rate: 10, By: "device"}},
+		{name: "unknown store", conf: oconf.RateLimitConf{Method: AnyMethod, Rate: 10, Store: "memcache"}},
+		{name: "redis not connected", conf: oconf.RateLimitConf{Method: AnyMethod, Rate: 10, Store: RateLimitRedis}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := RateLimitRulesFromConf([]oconf.RateLimitConf{test.conf}, nil, nil)
+			assert.Equal(t, test.ok, err == nil)
+		})
+	}
+}
+
+func TestUnaryRateLimitInterceptor(t *testing.T) {
+	rules, err := RateLimitRulesFromConf([]oconf.RateLimitConf{
+		{Method: "/pkg.Svc/Get", Rate: 1, Period: 60},
+	}, nil, nil)
+	assert.Nil(t, err)
+	interceptor := UnaryRateLimitInterceptor(rules)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(app, method string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(LabelApp, app))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.Nil(t, call("a", "/pkg.Svc/Get"))
+	err = call("a", "/pkg.Svc/Get")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, std.ErrTooManyRequests.Code, std.ErrFromGoErr(err).Code)
+	// other callers and methods are not limited
+	assert.Nil(t, call("b", "/pkg.Svc/Get"))
+	assert.Nil(t, call("a", "/pkg.Svc/List"))
+	// neither are the calls without the caller key
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}, handler)
+	assert.Nil(t, err)
+}
+
+func TestRateLimitByIp(t *testing.T) {
+	rules, err := RateLimitRulesFromConf([]oconf.RateLimitConf{
+		{Method: AnyMethod, By: RateLimitByIp, Rate: 1, Period: 60},
+	}, nil, []string{"10.0.0.1"})
+	assert.Nil(t, err)
+	interceptor := UnaryRateLimitInterceptor(rules)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(peerIp, forwarded string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(peerIp), Port: 1234},
+		})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(stdc.Md_CLIENTIP, forwarded))
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}, handler)
+		return err
+	}
+
+	// the forwarded ips of the untrusted peers are ignored
+	assert.Nil(t, call("1.2.3.4", "5.6.7.8"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("1.2.3.4", "5.6.7.9")))
+	// the trusted proxies are limited by the forwarded ones
+	assert.Nil(t, call("10.0.0.1", "5.6.7.8"))
+	assert.Nil(t, call("10.0.0.1", "5.6.7.9"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("10.0.0.1", "5.6.7.9")))
+}
@@ -0,0 +1,241 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RetryAttemptHeader carries the attempt number of a retried call, the first call doesn't have it
+	RetryAttemptHeader = "x-retry-attempt"
+	// AnyMethod matches all the methods in the retry policies
+	AnyMethod = "*"
+
+	defaultBackoffBase = 50 * time.Millisecond
+	defaultBackoffMax  = time.Second
+	defaultJitter      = 0.2
+
+	// like the retry throttling of grpc, a failure takes one token, a success gives back retryTokenRatio,
+	// and the retries stop when the tokens are less than the half of retryMaxTokens
+	retryMaxTokens  = 10
+	retryTokenRatio = 0.1
+
+	retryResultRetried   = "retried"
+	retryResultThrottled = "throttled"
+)
+
+type (
+	RetryPolicy struct {
+		MaxAttempts int
+		BackoffBase time.Duration
+		BackoffMax  time.Duration
+		Jitter      float64
+		// retryable codes, empty means Unavailable and ResourceExhausted
+		Codes []codes.Code
+	}
+
+	retryBudget struct {
+		lock   sync.Mutex
+		tokens float64
+	}
+
+	attemptKey struct{}
+)
+
+var (
+	// the codes retried by default, the ones the calls surely failed to be served, not DeadlineExceeded
+	// or Internal, which may be served already, like the unmapped 5xx Errs of the services
+	defaultRetryCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted}
+
+	retryBudgets     = make(map[string]*retryBudget)
+	retryBudgetsLock sync.Mutex
+)
+
+// RetryPolicyFromConf converts the retry config, the unknown codes are reported as error.
+func RetryPolicyFromConf(c oconf.RetryConf) (RetryPolicy, error) {
+	policy := RetryPolicy{
+		MaxAttempts: c.MaxAttempts,
+		BackoffBase: time.Duration(c.BackoffBase) * time.Millisecond,
+		BackoffMax:  time.Duration(c.BackoffMax) * time.Millisecond,
+		Jitter:      c.Jitter,
+	}
+	for _, name := range c.Codes {
+		code, ok := parseCode(name)
+		if !ok {
+			return policy, fmt.Errorf("retry: unknown code %q for method %s", name, c.Method)
+		}
+
+		policy.Codes = append(policy.Codes, code)
+	}
+
+	return policy, nil
+}
+
+// AttemptFromContext returns the attempt number of the call, 0 for the first call.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+// RetryInterceptor retries the failed calls of the methods in policies, keyed by full method or AnyMethod.
+// It should be chained after ClientTimeoutInterceptor, so that all the attempts share the deadline.
+func RetryInterceptor(target string, policies map[string]RetryPolicy) grpc.UnaryClientInterceptor {
+	budget := getRetryBudget(target)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := policies[method]
+		if !ok {
+			policy, ok = policies[AnyMethod]
+		}
+		if !ok || policy.MaxAttempts <= 1 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		var err error
+		for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+			if attempt > 0 {
+				if !budget.allow() {
+					observeRetry(target, method, err, retryResultThrottled)
+					return err
+				}
+
+				backoff := policy.backoff(attempt)
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+					return err
+				}
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return err
+				}
+				observeRetry(target, method, err, retryResultRetried)
+			}
+
+			attemptCtx := ctx
+			if attempt > 0 {
+				attemptCtx = context.WithValue(ctx, attemptKey{}, attempt)
+				attemptCtx = metadata.AppendToOutgoingContext(attemptCtx, RetryAttemptHeader, strconv.Itoa(attempt))
+			}
+			err = invoker(attemptCtx, method, req, reply, cc, opts...)
+			if err == nil || !policy.retryable(err) {
+				budget.onSuccess()
+				return err
+			}
+			budget.onFailure()
+		}
+
+		return err
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if len(p.Codes) == 0 {
+		return hasCode(defaultRetryCodes, status.Code(err))
+	}
+
+	return hasCode(p.Codes, status.Code(err))
+}
+
+func hasCode(candidates []codes.Code, code codes.Code) bool {
+	for _, c := range candidates {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the exponential delay before the attempt, jittered by Jitter in both directions.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	base, max, jitter := p.BackoffBase, p.BackoffMax, p.Jitter
+	if base <= 0 {
+		base = defaultBackoffBase
+	}
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	if jitter <= 0 || jitter > 1 {
+		jitter = defaultJitter
+	}
+
+	delay := math.Min(float64(base)*math.Pow(2, float64(attempt-1)), float64(max))
+	delay *= 1 + jitter*(rand.Float64()*2-1)
+
+	return time.Duration(delay)
+}
+
+func getRetryBudget(target string) *retryBudget {
+	retryBudgetsLock.Lock()
+	defer retryBudgetsLock.Unlock()
+
+	budget, ok := retryBudgets[target]
+	if !ok {
+		budget = &retryBudget{tokens: retryMaxTokens}
+		retryBudgets[target] = budget
+	}
+
+	return budget
+}
+
+func (b *retryBudget) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.tokens > retryMaxTokens/2
+}
+
+func (b *retryBudget) onSuccess() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens = math.Min(b.tokens+retryTokenRatio, retryMaxTokens)
+}
+
+func (b *retryBudget) onFailure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens = math.Max(b.tokens-1, 0)
+}
+
+func parseCode(name string) (codes.Code, bool) {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == name {
+			return c, true
+		}
+	}
+
+	return codes.Unknown, false
+}
+
+func observeRetry(target, method string, err error, result string) {
+	if !isPrometheusEnabled() {
+		return
+	}
+
+	labels, lerr := RetryLabels.CreatePromLabels(map[string]string{
+		LabelNamespace:      "one",
+		LabelSourceApp:      svcName,
+		LabelTarget:         target,
+		LabelMethod:         method,
+		LabelResponseStatus: GetStatusFromGrpcResponseErr(err),
+		LabelRetryResult:    result,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+
+	GetPromMonitor().IncrRetryTotal(labels)
+}
@@ -0,0 +1,169 @@
+package interceptor
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func countingInvoker(calls *int, errs ...error) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		opts ...grpc.CallOption) error {
+		defer func() {
+			*calls++
+		}()
+		if *calls < len(errs) {
+			return errs[*calls]
+		}
+		return nil
+	}
+}
+
+func resetRetryBudgets() {
+	retryBudgetsLock.Lock()
+	defer retryBudgetsLock.Unlock()
+	retryBudgets = make(map[string]*retryBudget)
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	resetRetryBudgets()
+	var (
+		unavailable = status.Error(codes.Unavailable, "unavailable")
+		notFound    = status.Error(codes.NotFound, "not found")
+		internal    = status.Error(codes.Internal, "internal")
+		policies    = map[string]RetryPolicy{
+			"/pkg.Svc/Get": {
+				MaxAttempts: 3,
+				BackoffBase: time.Millisecond,
+			},
+			AnyMethod: {
+				MaxAttempts: 2,
+				BackoffBase: time.Millisecond,
+				Codes:       []codes.Code{codes.NotFound},
+			},
+		}
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		errs   []error
+		calls  int
+		err    error
+	}{
+		{
+			name:   "success after retries",
+			method: "/pkg.Svc/Get",
+			errs:   []error{unavailable, unavailable},
+			calls:  3,
+		},
+		{
+			name:   "attempts exhausted",
+			method: "/pkg.Svc/Get",
+			errs:   []error{unavailable, unavailable, unavailable, unavailable},
+			calls:  3,
+			err:    unavailable,
+		},
+		{
+			name:   "acceptable error",
+			method: "/pkg.Svc/Get",
+			errs:   []error{notFound},
+			calls:  1,
+			err:    notFound,
+		},
+		{
+			// may be served already, like the unmapped 5xx Errs
+			name:   "internal error",
+			method: "/pkg.Svc/Get",
+			errs:   []error{internal},
+			calls:  1,
+			err:    internal,
+		},
+		{
+			name:   "configured codes",
+			method: "/pkg.Svc/List",
+			errs:   []error{notFound, notFound},
+			calls:  2,
+			err:    notFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			interceptor := RetryInterceptor(test.name, policies)
+			err := interceptor(context.Background(), test.method, nil, nil, nil,
+				countingInvoker(&calls, test.errs...))
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.calls, calls)
+		})
+	}
+}
+
+func TestRetryInterceptorAttempts(t *testing.T) {
+	resetRetryBudgets()
+	var attempts []int
+	interceptor := RetryInterceptor("attempts", map[string]RetryPolicy{
+		AnyMethod: {MaxAttempts: 3, BackoffBase: time.Millisecond},
+	})
+	interceptor(context.Background(), "/pkg.Svc/Get", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			attempts = append(attempts, AttemptFromContext(ctx))
+			if len(attempts) > 1 {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				assert.Equal(t, []string{strconv.Itoa(len(attempts) - 1)}, md.Get(RetryAttemptHeader))
+			}
+			return status.Error(codes.Unavailable, "unavailable")
+		})
+	assert.Equal(t, []int{0, 1, 2}, attempts)
+}
+
+func TestRetryInterceptorDeadline(t *testing.T) {
+	resetRetryBudgets()
+	var calls int
+	interceptor := RetryInterceptor("deadline", map[string]RetryPolicy{
+		AnyMethod: {MaxAttempts: 3, BackoffBase: time.Second},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	err := interceptor(ctx, "/pkg.Svc/Get", nil, nil, nil,
+		countingInvoker(&calls, status.Error(codes.Unavailable, "unavailable")))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := &retryBudget{tokens: retryMaxTokens}
+	for i := 0; i < retryMaxTokens/2; i++ {
+		assert.True(t, budget.allow())
+		budget.onFailure()
+	}
+	assert.False(t, budget.allow())
+	for i := 0; i < 1/retryTokenRatio+1; i++ {
+		budget.onSuccess()
+	}
+	assert.True(t, budget.allow())
+}
+
+func TestRetryPolicyFromConf(t *testing.T) {
+	policy, err := RetryPolicyFromConf(oconf.RetryConf{
+		MaxAttempts: 3,
+		BackoffBase: 10,
+		Codes:       []string{"Unavailable", "Aborted"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Millisecond, policy.BackoffBase)
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.Aborted}, policy.Codes)
+
+	_, err = RetryPolicyFromConf(oconf.RetryConf{Codes: []string{"Broken"}})
+	assert.NotNil(t, err)
+}
@@ -20,12 +20,20 @@ func GetSentryServerInterceptors() ([]grpc.UnaryServerInterceptor, []grpc.Stream
 func GetSentryUnaryServerInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 		defer std.RecoverRepanicWithSentry(ctx, req)
-		return handler(ctx, req)
+		resp, err = handler(ctx, req)
+		if err != nil {
+			std.CaptureErrWithSentry(ctx, req, err)
+		}
+		return resp, err
 	}
 }
 func GetSentryStreamServerInterceptor() grpc.StreamServerInterceptor {
 	return func(src interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		defer std.RecoverRepanicWithSentry(context.Background(), nil)
-		return handler(src, ss)
+		err := handler(src, ss)
+		if err != nil {
+			std.CaptureErrWithSentry(ss.Context(), nil, err)
+		}
+		return err
 	}
 }
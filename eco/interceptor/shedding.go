@@ -0,0 +1,105 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/common/log"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"github.com/wednesdaysunny/onerpc/eco/load"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	sheddingPass = "pass"
+	sheddingDrop = "drop"
+)
+
+// UnarySheddingInterceptor rejects the calls with ResourceExhausted, carrying ErrServerTooBusy,
+// when the shedder is overloaded.
+func UnarySheddingInterceptor(shedder *load.Shedder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (resp interface{}, err error) {
+		// never fail the health probes, or the overloaded pods get killed
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(ctx, req)
+		}
+
+		promise, err := shedder.Allow()
+		if err != nil {
+			observeShedding(info.FullMethod, sheddingDrop)
+			return nil, std.ErrServerTooBusy.Status().Err()
+		}
+		observeShedding(info.FullMethod, sheddingPass)
+
+		defer func() {
+			finishPromise(promise, err)
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamSheddingInterceptor rejects the streams with ResourceExhausted, carrying ErrServerTooBusy,
+// when the shedder is overloaded, the latency of a stream is counted from start to end.
+func StreamSheddingInterceptor(shedder *load.Shedder) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(srv, stream)
+		}
+
+		promise, err := shedder.Allow()
+		if err != nil {
+			observeShedding(info.FullMethod, sheddingDrop)
+			return std.ErrServerTooBusy.Status().Err()
+		}
+		observeShedding(info.FullMethod, sheddingPass)
+
+		defer func() {
+			finishPromise(promise, err)
+		}()
+
+		return handler(srv, stream)
+	}
+}
+
+func finishPromise(promise load.Promise, err error) {
+	// the timed out calls are the sign of overloading, their latencies are meaningless
+	if status.Code(err) == codes.DeadlineExceeded || err == context.DeadlineExceeded {
+		promise.Fail()
+	} else {
+		promise.Pass()
+	}
+}
+
+func observeShedding(method, result string) {
+	if !isPrometheusEnabled() {
+		return
+	}
+
+	labels, lerr := SheddingLabels.CreatePromLabels(map[string]string{
+		LabelNamespace:      "one",
+		LabelSourceApp:      svcName,
+		LabelMethod:         method,
+		LabelSheddingResult: result,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+	cpuLabels, lerr := SheddingCpuLabels.CreatePromLabels(map[string]string{
+		LabelNamespace: "one",
+		LabelSourceApp: svcName,
+	})
+	if lerr != nil {
+		log.Errorln("CreatePromLabels", lerr)
+		return
+	}
+
+	metricClient := GetPromMonitor()
+	metricClient.IncrSheddingTotal(labels)
+	metricClient.SetSheddingCpu(cpuLabels, float64(load.CpuUsage()))
+}
@@ -0,0 +1,467 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// the long streams log the first messages only, to keep the spans small
+const maxStreamSpanEvents = 100
+
+type (
+	// messageHook is called after a message is sent or received, err is the one of SendMsg or RecvMsg.
+	messageHook func(m interface{}, err error)
+
+	monitoredServerStream struct {
+		grpc.ServerStream
+		ctx    context.Context
+		onSend messageHook
+		onRecv messageHook
+	}
+
+	monitoredClientStream struct {
+		grpc.ClientStream
+		onSend  messageHook
+		onRecv  messageHook
+		wrapErr func(err error) error
+	}
+
+	streamStats struct {
+		sent          int64
+		received      int64
+		sentBytes     int64
+		receivedBytes int64
+	}
+
+	// streamSpan logs the messages on the span, and finishes it once.
+	streamSpan struct {
+		span   opentracing.Span
+		events int64
+		once   sync.Once
+	}
+
+	// idleTimer cancels the stream once no message is sent or received in the idle timeout.
+	idleTimer struct {
+		timer   *time.Timer
+		timeout time.Duration
+		fired   int32
+	}
+)
+
+// StreamLoggingInterceptor logs the streams on open and close, with the message counts, bytes and duration.
+func StreamLoggingInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	ctx := ss.Context()
+	logField := accessLogFields(ctx, info.FullMethod)
+	logField["stream_event"] = "open"
+	logField["client_stream"] = info.IsClientStream
+	logField["server_stream"] = info.IsServerStream
+	oc.LogUserActivity(logField, "grpcaccess")
+
+	var stats streamStats
+	start := time.Now()
+	err := handler(srv, &monitoredServerStream{
+		ServerStream: ss,
+		ctx:          ctx,
+		onSend:       stats.onSend,
+		onRecv:       stats.onRecv,
+	})
+	l := time.Since(start)
+
+	logField = accessLogFields(ctx, info.FullMethod)
+	logField["stream_event"] = "close"
+	logField["client_stream"] = info.IsClientStream
+	logField["server_stream"] = info.IsServerStream
+	logField["latency"] = l.Nanoseconds() / 1000000
+	logField["latency_human"] = l.String()
+	stats.addFields(logField)
+	if err != nil {
+		logField["is_error"] = true
+		logField["err_message"] = err.Error()
+		addErrFields(logField, err)
+	}
+	oc.LogUserActivity(logField, "grpcaccess")
+
+	return err
+}
+
+// StreamClientLoggingInterceptor logs the streams to target on open and close,
+// with the message counts, bytes and duration.
+func StreamClientLoggingInterceptor(target string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		fields := func(event string) oc.LogFields {
+			return oc.LogFields{
+				"type":          "grpcclient",
+				"stream_event":  event,
+				"target":        target,
+				"grpc_method":   method,
+				"app":           svcName,
+				"client_stream": desc.ClientStreams,
+				"server_stream": desc.ServerStreams,
+			}
+		}
+
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			logField := fields("close")
+			logField["is_error"] = true
+			logField["err_message"] = err.Error()
+			oc.LogUserActivity(logField, "grpcclient")
+			return nil, err
+		}
+		oc.LogUserActivity(fields("open"), "grpcclient")
+
+		var (
+			stats   streamStats
+			lastErr atomic.Value
+		)
+		go func() {
+			// done once the stream finished, or the context of the caller cancelled
+			<-stream.Context().Done()
+			l := time.Since(start)
+			logField := fields("close")
+			logField["latency"] = l.Nanoseconds() / 1000000
+			logField["latency_human"] = l.String()
+			stats.addFields(logField)
+			if err, ok := lastErr.Load().(error); ok {
+				logField["is_error"] = true
+				logField["err_message"] = err.Error()
+			}
+			oc.LogUserActivity(logField, "grpcclient")
+		}()
+
+		return &monitoredClientStream{
+			ClientStream: stream,
+			onSend:       stats.onSend,
+			onRecv: func(m interface{}, err error) {
+				stats.onRecv(m, err)
+				if err != nil && err != io.EOF {
+					lastErr.Store(err)
+				}
+			},
+		}, nil
+	}
+}
+
+// StreamServerTracingInterceptor traces the streams, with the messages logged on the span.
+func StreamServerTracingInterceptor(serviceName string) grpc.StreamServerInterceptor {
+	if !IsGlobalTracerRegistered(serviceName) {
+		return nil
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			md = metadata.New(nil)
+		}
+
+		spanContext, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, MDReaderWriter{md})
+		if err != nil && err != opentracing.ErrSpanContextNotFound {
+			grpclog.Errorf("extract from metadata err: %v", err)
+			return handler(srv, ss)
+		}
+
+		span := &streamSpan{
+			span: opentracing.GlobalTracer().StartSpan(
+				info.FullMethod,
+				ext.RPCServerOption(spanContext),
+				opentracing.Tag{Key: string(ext.Component), Value: "gRPC"},
+				ext.SpanKindRPCServer,
+			),
+		}
+		err = handler(srv, &monitoredServerStream{
+			ServerStream: ss,
+			ctx:          opentracing.ContextWithSpan(ctx, span.span),
+			onSend:       span.onMessage("message.sent"),
+			onRecv:       span.onMessage("message.received"),
+		})
+		span.finish(err)
+
+		return err
+	}
+}
+
+// StreamClientTracingInterceptor traces the streams, with the messages logged on the span.
+func StreamClientTracingInterceptor() grpc.StreamClientInterceptor {
+	if !opentracing.IsGlobalTracerRegistered() {
+		return nil
+	}
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var parentCtx opentracing.SpanContext
+		if parentSpan := opentracing.SpanFromContext(ctx); parentSpan != nil {
+			parentCtx = parentSpan.Context()
+		}
+
+		span := &streamSpan{
+			span: opentracing.GlobalTracer().StartSpan(
+				method,
+				opentracing.ChildOf(parentCtx),
+				opentracing.Tag{Key: string(ext.Component), Value: "gRPC"},
+				ext.SpanKindRPCClient,
+			),
+		}
+
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if !ok {
+			md = metadata.New(nil)
+		} else {
+			md = md.Copy()
+		}
+		if err := opentracing.GlobalTracer().Inject(span.span.Context(), opentracing.TextMap, MDReaderWriter{md}); err != nil {
+			span.span.LogFields(log.String("inject-error", err.Error()))
+		}
+
+		stream, err := streamer(metadata.NewOutgoingContext(ctx, md), desc, cc, method, opts...)
+		if err != nil {
+			span.finish(err)
+			return nil, err
+		}
+		go func() {
+			<-stream.Context().Done()
+			span.finish(nil)
+		}()
+
+		onRecv := span.onMessage("message.received")
+		return &monitoredClientStream{
+			ClientStream: stream,
+			onSend:       span.onMessage("message.sent"),
+			onRecv: func(m interface{}, err error) {
+				onRecv(m, err)
+				if err == io.EOF {
+					span.finish(nil)
+				} else if err != nil {
+					span.finish(err)
+				}
+			},
+		}, nil
+	}
+}
+
+// StreamTimeoutInterceptor cancels the streams running longer than the timeout of the method,
+// or idle longer than idle, the timeouts not positive mean no timeout. Like UnaryTimeoutInterceptor,
+// DeadlineExceeded is returned without waiting for the handler.
+func StreamTimeoutInterceptor(idle, timeout time.Duration, methods map[string]time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		t := TimeoutFor(info.FullMethod, timeout, methods)
+		if t <= 0 && idle <= 0 {
+			return handler(srv, ss)
+		}
+
+		ctx, cancel := withStreamTimeout(ss.Context(), t)
+		defer cancel()
+		timer := newIdleTimer(idle, cancel)
+		defer timer.stop()
+
+		var err error
+		if cerr := runUntilDone(ctx, info.FullMethod, func() {
+			err = handler(srv, &monitoredServerStream{
+				ServerStream: ss,
+				ctx:          ctx,
+				onSend:       timer.onMessage,
+				onRecv:       timer.onMessage,
+			})
+		}); cerr != nil {
+			return timer.wrapErr(contextStatus(cerr))
+		}
+
+		return err
+	}
+}
+
+// StreamClientTimeoutInterceptor cancels the streams running longer than timeout, or idle longer than idle,
+// the timeouts not positive mean no timeout.
+func StreamClientTimeoutInterceptor(idle, timeout time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if timeout <= 0 && idle <= 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx, cancel := withStreamTimeout(ctx, timeout)
+		timer := newIdleTimer(idle, cancel)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			timer.stop()
+			cancel()
+			return nil, err
+		}
+		go func() {
+			<-stream.Context().Done()
+			timer.stop()
+			cancel()
+		}()
+
+		return &monitoredClientStream{
+			ClientStream: stream,
+			onSend:       timer.onMessage,
+			onRecv:       timer.onMessage,
+			wrapErr:      timer.wrapErr,
+		}, nil
+	}
+}
+
+func withStreamTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+func (s *monitoredServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *monitoredServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if s.onSend != nil {
+		s.onSend(m, err)
+	}
+
+	return err
+}
+
+func (s *monitoredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if s.onRecv != nil {
+		s.onRecv(m, err)
+	}
+
+	return err
+}
+
+func (s *monitoredClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if s.onSend != nil {
+		s.onSend(m, err)
+	}
+	if err != nil && s.wrapErr != nil {
+		err = s.wrapErr(err)
+	}
+
+	return err
+}
+
+func (s *monitoredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if s.onRecv != nil {
+		s.onRecv(m, err)
+	}
+	if err != nil && err != io.EOF && s.wrapErr != nil {
+		err = s.wrapErr(err)
+	}
+
+	return err
+}
+
+func (s *streamStats) onSend(m interface{}, err error) {
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+		atomic.AddInt64(&s.sentBytes, int64(messageSize(m)))
+	}
+}
+
+func (s *streamStats) onRecv(m interface{}, err error) {
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+		atomic.AddInt64(&s.receivedBytes, int64(messageSize(m)))
+	}
+}
+
+func (s *streamStats) addFields(fields oc.LogFields) {
+	fields["msgs_sent"] = atomic.LoadInt64(&s.sent)
+	fields["msgs_received"] = atomic.LoadInt64(&s.received)
+	fields["bytes_sent"] = atomic.LoadInt64(&s.sentBytes)
+	fields["bytes_received"] = atomic.LoadInt64(&s.receivedBytes)
+}
+
+func (s *streamSpan) onMessage(event string) messageHook {
+	return func(m interface{}, err error) {
+		if err != nil {
+			return
+		}
+
+		switch n := atomic.AddInt64(&s.events, 1); {
+		case n <= maxStreamSpanEvents:
+			s.span.LogFields(log.String("event", event), log.Int("size", messageSize(m)))
+		case n == maxStreamSpanEvents+1:
+			s.span.LogFields(log.String("event", "messages.truncated"))
+		}
+	}
+}
+
+func (s *streamSpan) finish(err error) {
+	s.once.Do(func() {
+		s.span.SetTag("rpc.messages", atomic.LoadInt64(&s.events))
+		if err != nil {
+			ext.Error.Set(s.span, true)
+			s.span.LogFields(log.String("call-error", err.Error()))
+		}
+		s.span.Finish()
+	})
+}
+
+func newIdleTimer(timeout time.Duration, cancel context.CancelFunc) *idleTimer {
+	t := &idleTimer{
+		timeout: timeout,
+	}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&t.fired, 1)
+			cancel()
+		})
+	}
+
+	return t
+}
+
+func (t *idleTimer) onMessage(m interface{}, err error) {
+	if t.timer != nil && err == nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// wrapErr converts the error caused by the idle timeout to DeadlineExceeded.
+func (t *idleTimer) wrapErr(err error) error {
+	if atomic.LoadInt32(&t.fired) == 0 {
+		return err
+	}
+
+	return status.Error(codes.DeadlineExceeded, fmt.Sprintf("stream idle for %v", t.timeout))
+}
+
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+
+	return 0
+}
@@ -0,0 +1,145 @@
+package interceptor
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	mockServerStream struct {
+		grpc.ServerStream
+		ctx context.Context
+	}
+
+	mockClientStream struct {
+		grpc.ClientStream
+		ctx context.Context
+	}
+)
+
+func (s *mockServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *mockServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *mockServerStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
+func (s *mockClientStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *mockClientStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *mockClientStream) RecvMsg(m interface{}) error {
+	<-s.ctx.Done()
+	return status.FromContextError(s.ctx.Err()).Err()
+}
+
+// sendEvery sends a message every interval until the stream is cancelled.
+func sendEvery(interval time.Duration) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			select {
+			case <-time.After(interval):
+				if err := stream.SendMsg(&wrappers.StringValue{Value: "tick"}); err != nil {
+					return err
+				}
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+	}
+}
+
+func TestStreamTimeoutInterceptor(t *testing.T) {
+	interceptor := StreamTimeoutInterceptor(time.Millisecond*50, time.Millisecond*200, map[string]time.Duration{
+		"/pkg.Svc/Short": time.Millisecond * 30,
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		handler grpc.StreamHandler
+		idle    bool
+	}{
+		{name: "idle", method: "/pkg.Svc/Watch", handler: sendEvery(time.Second), idle: true},
+		{name: "total", method: "/pkg.Svc/Watch", handler: sendEvery(time.Millisecond * 10)},
+		{name: "overridden", method: "/pkg.Svc/Short", handler: sendEvery(time.Millisecond * 10)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			err := interceptor(nil, &mockServerStream{ctx: context.Background()},
+				&grpc.StreamServerInfo{FullMethod: test.method}, test.handler)
+			assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+			assert.Equal(t, test.idle, strings.Contains(status.Convert(err).Message(), "idle"))
+			assert.True(t, time.Since(start) < time.Millisecond*500)
+		})
+	}
+}
+
+func TestStreamTimeoutInterceptorNoTimeout(t *testing.T) {
+	interceptor := StreamTimeoutInterceptor(0, 0, nil)
+	err := interceptor(nil, &mockServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			_, ok := stream.Context().Deadline()
+			assert.False(t, ok)
+			return io.EOF
+		})
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStreamClientTimeoutInterceptor(t *testing.T) {
+	interceptor := StreamClientTimeoutInterceptor(time.Millisecond*30, time.Second)
+	stream, err := interceptor(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/pkg.Svc/Watch",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+			opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &mockClientStream{ctx: ctx}, nil
+		})
+	assert.Nil(t, err)
+
+	err = stream.RecvMsg(&wrappers.StringValue{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "idle")
+}
+
+func TestStreamStats(t *testing.T) {
+	var stats streamStats
+	stream := &monitoredServerStream{
+		ServerStream: &mockServerStream{ctx: context.Background()},
+		ctx:          context.Background(),
+		onSend:       stats.onSend,
+		onRecv:       stats.onRecv,
+	}
+	assert.Nil(t, stream.SendMsg(&wrappers.StringValue{Value: "hello"}))
+	assert.Nil(t, stream.SendMsg(&wrappers.StringValue{Value: "world"}))
+	assert.Nil(t, stream.RecvMsg(&wrappers.StringValue{}))
+	stats.onRecv(&wrappers.StringValue{Value: "lost"}, io.EOF)
+
+	fields := oc.LogFields{}
+	stats.addFields(fields)
+	assert.Equal(t, oc.LogFields{
+		"msgs_sent":      int64(2),
+		"msgs_received":  int64(1),
+		"bytes_sent":     int64(14),
+		"bytes_received": int64(0),
+	}, fields)
+}
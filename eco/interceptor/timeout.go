@@ -0,0 +1,117 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultServerTimeout = time.Second * 2
+	// the handlers still running this long after the deadline are reported as leaking
+	leakGracePeriod = time.Second
+)
+
+type panicInfo struct {
+	value interface{}
+	stack string
+}
+
+// TimeoutFor returns the timeout of the full method, the one in methods if set, otherwise timeout,
+// the timeouts not positive mean no timeout.
+func TimeoutFor(fullMethod string, timeout time.Duration, methods map[string]time.Duration) time.Duration {
+	if t, ok := methods[fullMethod]; ok {
+		return t
+	}
+
+	return timeout
+}
+
+// UnaryTimeoutInterceptor cancels the context of the handler when the timeout or the deadline of the call,
+// whichever comes first, passes, and returns DeadlineExceeded without waiting for the handler.
+// The handlers ignoring the cancellation are reported, since their goroutines leak.
+func UnaryTimeoutInterceptor(timeout time.Duration, methods map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		t := TimeoutFor(info.FullMethod, timeout, methods)
+		if t <= 0 {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, t)
+		defer cancel()
+
+		var (
+			resp interface{}
+			err  error
+		)
+		if cerr := runUntilDone(ctx, info.FullMethod, func() {
+			resp, err = handler(ctx, req)
+		}); cerr != nil {
+			return nil, contextStatus(cerr)
+		}
+
+		return resp, err
+	}
+}
+
+// runUntilDone runs fn in a goroutine, and returns ctx.Err() once ctx is done without waiting for fn,
+// the panics of fn are raised in the calling goroutine, to be handled by the recover interceptors.
+func runUntilDone(ctx context.Context, method string, fn func()) error {
+	var (
+		start  = time.Now()
+		done   = make(chan struct{})
+		panics = make(chan panicInfo, 1)
+	)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panics <- panicInfo{value: p, stack: string(debug.Stack())}
+			}
+		}()
+
+		fn()
+		close(done)
+	}()
+
+	select {
+	case p := <-panics:
+		oc.LogErrorc("timeout", fmt.Errorf("%v", p.value), p.stack)
+		panic(p.value)
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		go watchLeak(method, start, done, panics)
+		return ctx.Err()
+	}
+}
+
+// contextStatus converts the context error to the grpc status error.
+func contextStatus(err error) error {
+	if err == context.Canceled {
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	return status.Error(codes.DeadlineExceeded, err.Error())
+}
+
+// watchLeak reports the handler that is still running leakGracePeriod after its deadline.
+func watchLeak(method string, start time.Time, done chan struct{}, panics chan panicInfo) {
+	timer := time.NewTimer(leakGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case p := <-panics:
+		oc.LogErrorc("timeout", fmt.Errorf("%v", p.value), fmt.Sprintf("%s panicked after deadline: %s", method, p.stack))
+	case <-timer.C:
+		oc.LogWarnc("timeout", nil, fmt.Sprintf("%s still running %v after started, the handler ignores "+
+			"the context cancellation, which leaks the goroutine", method, time.Since(start)))
+	}
+}
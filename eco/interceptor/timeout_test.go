@@ -0,0 +1,75 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryTimeoutInterceptor(t *testing.T) {
+	interceptor := UnaryTimeoutInterceptor(time.Millisecond*50, map[string]time.Duration{
+		"/pkg.Svc/Slow": time.Millisecond * 200,
+		"/pkg.Svc/Job":  0,
+	})
+	sleep := func(d time.Duration) grpc.UnaryHandler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			select {
+			case <-time.After(d):
+				return "done", nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		handler grpc.UnaryHandler
+		code    codes.Code
+	}{
+		{name: "in time", method: "/pkg.Svc/Get", handler: sleep(time.Millisecond), code: codes.OK},
+		{name: "timed out", method: "/pkg.Svc/Get", handler: sleep(time.Second), code: codes.DeadlineExceeded},
+		{name: "overridden", method: "/pkg.Svc/Slow", handler: sleep(time.Millisecond * 100), code: codes.OK},
+		{name: "no timeout", method: "/pkg.Svc/Job", handler: sleep(time.Millisecond * 100), code: codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: test.method}, test.handler)
+			assert.Equal(t, test.code, status.Code(err))
+		})
+	}
+}
+
+func TestUnaryTimeoutInterceptorCancel(t *testing.T) {
+	interceptor := UnaryTimeoutInterceptor(time.Millisecond*20, nil)
+	cancelled := make(chan struct{})
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context not cancelled")
+	}
+}
+
+func TestUnaryTimeoutInterceptorPanic(t *testing.T) {
+	interceptor := UnaryTimeoutInterceptor(time.Second, nil)
+	assert.Panics(t, func() {
+		interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("boom")
+			})
+	})
+}
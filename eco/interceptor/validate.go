@@ -0,0 +1,130 @@
+package interceptor
+
+import (
+	"context"
+
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+)
+
+type (
+	// validator is implemented by the messages generated by protoc-gen-validate, or by hand.
+	validator interface {
+		Validate() error
+	}
+
+	// allValidator reports all the violations instead of the first one, preferred over validator.
+	allValidator interface {
+		ValidateAll() error
+	}
+
+	// multiError is the error of ValidateAll.
+	multiError interface {
+		AllErrors() []error
+	}
+
+	// fieldError is the error of a field, the embedded messages have their errors as the causes.
+	fieldError interface {
+		Field() string
+		Reason() string
+	}
+
+	causer interface {
+		Cause() error
+	}
+
+	validatingServerStream struct {
+		grpc.ServerStream
+	}
+)
+
+// UnaryValidateInterceptor validates the requests implementing Validate or ValidateAll, the invalid ones
+// are rejected with InvalidArgument, carrying ErrParams and the field violations as google.rpc.BadRequest.
+func UnaryValidateInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// StreamValidateInterceptor validates each message received, see UnaryValidateInterceptor.
+func StreamValidateInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	return handler(srv, &validatingServerStream{ServerStream: stream})
+}
+
+func (s *validatingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return validate(m)
+}
+
+func validate(m interface{}) error {
+	var err error
+	switch v := m.(type) {
+	case allValidator:
+		err = v.ValidateAll()
+	case validator:
+		err = v.Validate()
+	}
+	if err == nil {
+		return nil
+	}
+
+	// the ErrorInfo of ErrParams first, so that the clients rebuild it by the details
+	st := std.ErrParams.Status()
+	if detailed, derr := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: fieldViolations("", err),
+	}); derr == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
+
+// fieldViolations flattens err into the violations, the fields of the embedded messages are dotted.
+func fieldViolations(prefix string, err error) []*errdetails.BadRequest_FieldViolation {
+	if multi, ok := err.(multiError); ok {
+		var violations []*errdetails.BadRequest_FieldViolation
+		for _, item := range multi.AllErrors() {
+			violations = append(violations, fieldViolations(prefix, item)...)
+		}
+		return violations
+	}
+
+	fe, ok := err.(fieldError)
+	if !ok {
+		return []*errdetails.BadRequest_FieldViolation{
+			{
+				Field:       prefix,
+				Description: err.Error(),
+			},
+		}
+	}
+
+	field := fe.Field()
+	if len(prefix) > 0 {
+		field = prefix + "." + field
+	}
+	if c, ok := err.(causer); ok && c.Cause() != nil {
+		cause := c.Cause()
+		if _, ok := cause.(fieldError); ok {
+			return fieldViolations(field, cause)
+		}
+		if _, ok := cause.(multiError); ok {
+			return fieldViolations(field, cause)
+		}
+	}
+
+	return []*errdetails.BadRequest_FieldViolation{
+		{
+			Field:       field,
+			Description: fe.Reason(),
+		},
+	}
+}
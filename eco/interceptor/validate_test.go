@@ -0,0 +1,171 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	// mockValidationError is like the errors generated by protoc-gen-validate.
+	mockValidationError struct {
+		field  string
+		reason string
+		cause  error
+	}
+
+	mockMultiError []error
+
+	mockRequest struct {
+		err error
+	}
+
+	mockAllRequest struct {
+		mockRequest
+		all error
+	}
+
+	recvServerStream struct {
+		grpc.ServerStream
+		msgs []interface{}
+	}
+)
+
+func (e mockValidationError) Error() string {
+	return e.field + ": " + e.reason
+}
+
+func (e mockValidationError) Field() string {
+	return e.field
+}
+
+func (e mockValidationError) Reason() string {
+	return e.reason
+}
+
+func (e mockValidationError) Cause() error {
+	return e.cause
+}
+
+func (m mockMultiError) Error() string {
+	return "multiple errors"
+}
+
+func (m mockMultiError) AllErrors() []error {
+	return m
+}
+
+func (r *mockRequest) Validate() error {
+	return r.err
+}
+
+func (r *mockAllRequest) ValidateAll() error {
+	return r.all
+}
+
+func (s *recvServerStream) RecvMsg(m interface{}) error {
+	*m.(*mockRequest) = *s.msgs[0].(*mockRequest)
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func violationsOf(t *testing.T, err error) map[string]string {
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	e, ok := std.ErrFromStatus(st)
+	assert.True(t, ok)
+	assert.Equal(t, std.ErrParams.Code, e.Code)
+
+	violations := make(map[string]string)
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				violations[v.GetField()] = v.GetDescription()
+			}
+		}
+	}
+
+	return violations
+}
+
+func TestUnaryValidateInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+
+	tests := []struct {
+		name       string
+		req        interface{}
+		violations map[string]string
+	}{
+		{name: "no validator", req: "raw"},
+		{name: "valid", req: &mockRequest{}},
+		{
+			name:       "invalid",
+			req:        &mockRequest{err: mockValidationError{field: "Id", reason: "value must be greater than 0"}},
+			violations: map[string]string{"Id": "value must be greater than 0"},
+		},
+		{
+			name:       "by hand",
+			req:        &mockRequest{err: errors.New("bad request")},
+			violations: map[string]string{"": "bad request"},
+		},
+		{
+			name: "all",
+			req: &mockAllRequest{
+				mockRequest: mockRequest{err: mockValidationError{field: "Id", reason: "first only"}},
+				all: mockMultiError{
+					mockValidationError{field: "Id", reason: "value must be greater than 0"},
+					mockValidationError{field: "Address", reason: "embedded message failed validation",
+						cause: mockValidationError{field: "City", reason: "value length must be at least 1 runes"}},
+				},
+			},
+			violations: map[string]string{
+				"Id":           "value must be greater than 0",
+				"Address.City": "value length must be at least 1 runes",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := UnaryValidateInterceptor(context.Background(), test.req, info, handler)
+			if test.violations == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, "ok", resp)
+				return
+			}
+
+			assert.Nil(t, resp)
+			assert.Equal(t, test.violations, violationsOf(t, err))
+		})
+	}
+}
+
+func TestStreamValidateInterceptor(t *testing.T) {
+	stream := &recvServerStream{msgs: []interface{}{
+		&mockRequest{},
+		&mockRequest{err: mockValidationError{field: "Id", reason: "value must be greater than 0"}},
+	}}
+	var received int
+	err := StreamValidateInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/Upload"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				var req mockRequest
+				if err := stream.RecvMsg(&req); err != nil {
+					return err
+				}
+				received++
+			}
+		})
+	assert.Equal(t, 1, received)
+	assert.Equal(t, map[string]string{"Id": "value must be greater than 0"}, violationsOf(t, err))
+}
@@ -0,0 +1,188 @@
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	onet "github.com/wednesdaysunny/onerpc/eco/inter/toolkit/net"
+	"gopkg.in/redis.v5"
+)
+
+const reloadInterval = time.Second * 10
+
+type (
+	// Lists is the format of the lists in the file or redis.
+	Lists struct {
+		Allow []string `json:"allow" yaml:"allow"`
+		Deny  []string `json:"deny" yaml:"deny"`
+	}
+
+	// Filter checks the ips against the allow and deny lists, the lists of the sources,
+	// like the static config, the file and redis, are merged.
+	Filter struct {
+		lock    sync.RWMutex
+		trusted []*net.IPNet
+		sources map[string]Lists
+		allow   []*net.IPNet
+		deny    []*net.IPNet
+		stop    chan struct{}
+		once    sync.Once
+	}
+)
+
+// NewFilter creates the filter with the static lists in c, and starts reloading the file and redis if set,
+// client is required for the redis key.
+func NewFilter(c oconf.IPFilterConf, client *redis.Client) (*Filter, error) {
+	trusted, err := onet.ParseCIDRs(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		trusted: trusted,
+		sources: make(map[string]Lists),
+		stop:    make(chan struct{}),
+	}
+	if err := f.Update("config", Lists{Allow: c.Allow, Deny: c.Deny}); err != nil {
+		return nil, err
+	}
+
+	if len(c.File) > 0 {
+		load := func() (Lists, error) {
+			var lists Lists
+			err := oconf.LoadConfig(c.File, &lists)
+			return lists, err
+		}
+		if err := f.reload("file", load); err != nil {
+			return nil, err
+		}
+		go f.watch("file", load)
+	}
+
+	if len(c.RedisKey) > 0 {
+		if client == nil {
+			return nil, fmt.Errorf("ipfilter: redis not connected for %s", c.RedisKey)
+		}
+		load := func() (Lists, error) {
+			var lists Lists
+			content, err := client.Get(c.RedisKey).Bytes()
+			if err == redis.Nil {
+				return lists, nil
+			} else if err != nil {
+				return lists, err
+			}
+			err = json.Unmarshal(content, &lists)
+			return lists, err
+		}
+		if err := f.reload("redis", load); err != nil {
+			return nil, err
+		}
+		go f.watch("redis", load)
+	}
+
+	return f, nil
+}
+
+// Update replaces the lists of source, the invalid lists are rejected as a whole.
+func (f *Filter) Update(source string, lists Lists) error {
+	if _, err := onet.ParseCIDRs(lists.Allow); err != nil {
+		return fmt.Errorf("ipfilter: %s allow list: %v", source, err)
+	}
+	if _, err := onet.ParseCIDRs(lists.Deny); err != nil {
+		return fmt.Errorf("ipfilter: %s deny list: %v", source, err)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.sources[source] = lists
+	var allow, deny []string
+	for _, item := range f.sources {
+		allow = append(allow, item.Allow...)
+		deny = append(deny, item.Deny...)
+	}
+	// validated above
+	f.allow, _ = onet.ParseCIDRs(allow)
+	f.deny, _ = onet.ParseCIDRs(deny)
+
+	return nil
+}
+
+// Allow checks the peer ip, and the forwarded client ip if not nil. The calls are rejected
+// if either ip is denied. If the allow list is not empty, the forwarded ip is checked only if
+// the peer is a trusted proxy, otherwise the peer ip is checked.
+func (f *Filter) Allow(peer, forwarded net.IP) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if peer != nil && onet.IsIPWithin(peer, f.deny) {
+		return false
+	}
+	// a forged forwarded ip only makes the check stricter
+	if forwarded != nil && onet.IsIPWithin(forwarded, f.deny) {
+		return false
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+
+	ip := ClientIP(peer, forwarded, f.trusted)
+	return ip != nil && onet.IsIPWithin(ip, f.allow)
+}
+
+// ClientIP returns the ip of the client, the forwarded one only if not nil and the peer is a trusted proxy,
+// otherwise the peer, since the callers may forward any ip.
+func ClientIP(peer, forwarded net.IP, trusted []*net.IPNet) net.IP {
+	if forwarded != nil && peer != nil && onet.IsIPWithin(peer, trusted) {
+		return forwarded
+	}
+
+	return peer
+}
+
+// Stop stops reloading the lists.
+func (f *Filter) Stop() {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+}
+
+func (f *Filter) reload(source string, load func() (Lists, error)) error {
+	lists, err := load()
+	if err != nil {
+		return fmt.Errorf("ipfilter: fail to load %s: %v", source, err)
+	}
+
+	return f.Update(source, lists)
+}
+
+func (f *Filter) watch(source string, load func() (Lists, error)) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			// keep the old lists if the new ones are broken
+			if err := f.reload(source, load); err != nil {
+				oc.LogErrorc("ipfilter", err, "fail to reload the ip lists")
+			}
+		}
+	}
+}
+
+// ParseIP parses the ip, with or without the port, returns nil if invalid.
+func ParseIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return net.ParseIP(addr)
+}
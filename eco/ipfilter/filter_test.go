@@ -0,0 +1,102 @@
+package ipfilter
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+)
+
+func TestFilterAllow(t *testing.T) {
+	f, err := NewFilter(oconf.IPFilterConf{
+		Allow:          []string{"10.0.0.0/8", "192.168.1.1"},
+		Deny:           []string{"10.1.0.0/16"},
+		TrustedProxies: []string{"172.16.0.0/12"},
+	}, nil)
+	assert.Nil(t, err)
+	defer f.Stop()
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		allow     bool
+	}{
+		{name: "allowed peer", peer: "10.2.0.1", allow: true},
+		{name: "allowed single ip", peer: "192.168.1.1", allow: true},
+		{name: "denied peer", peer: "10.1.0.1"},
+		{name: "not in allow list", peer: "8.8.8.8"},
+		{name: "no peer", peer: ""},
+		{name: "forwarded by trusted proxy", peer: "172.16.0.1", forwarded: "10.2.0.1", allow: true},
+		{name: "forwarded denied", peer: "10.2.0.1", forwarded: "10.1.0.1"},
+		{name: "forwarded by untrusted peer", peer: "8.8.8.8", forwarded: "10.2.0.1"},
+		{name: "forwarded not in allow list", peer: "172.16.0.1", forwarded: "8.8.8.8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.allow, f.Allow(net.ParseIP(test.peer), net.ParseIP(test.forwarded)))
+		})
+	}
+}
+
+func TestFilterUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfilter")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ips.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"deny": ["1.2.3.4"]}`), 0644))
+
+	f, err := NewFilter(oconf.IPFilterConf{Deny: []string{"5.6.7.8"}, File: file}, nil)
+	assert.Nil(t, err)
+	defer f.Stop()
+	assert.False(t, f.Allow(ParseIP("1.2.3.4:5678"), nil))
+	assert.False(t, f.Allow(ParseIP("5.6.7.8"), nil))
+
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"deny": []}`), 0644))
+	assert.Nil(t, f.reload("file", func() (Lists, error) {
+		var lists Lists
+		err := oconf.LoadConfig(file, &lists)
+		return lists, err
+	}))
+	assert.True(t, f.Allow(ParseIP("1.2.3.4"), nil))
+	// the static lists are kept
+	assert.False(t, f.Allow(ParseIP("5.6.7.8"), nil))
+
+	// the broken lists are rejected
+	assert.NotNil(t, f.Update("file", Lists{Deny: []string{"bad"}}))
+	assert.True(t, f.Allow(ParseIP("1.2.3.4"), nil))
+
+	_, err = NewFilter(oconf.IPFilterConf{RedisKey: "ips"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []*net.IPNet{{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}}
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		ip        string
+	}{
+		{name: "untrusted peer", peer: "1.2.3.4", forwarded: "5.6.7.8", ip: "1.2.3.4"},
+		{name: "trusted peer", peer: "10.0.0.1", forwarded: "5.6.7.8", ip: "5.6.7.8"},
+		{name: "not forwarded", peer: "10.0.0.1", ip: "10.0.0.1"},
+		{name: "no peer", forwarded: "5.6.7.8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip := ClientIP(net.ParseIP(test.peer), net.ParseIP(test.forwarded), trusted)
+			if len(test.ip) == 0 {
+				assert.Nil(t, ip)
+			} else {
+				assert.Equal(t, test.ip, ip.String())
+			}
+		})
+	}
+}
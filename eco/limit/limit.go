@@ -0,0 +1,9 @@
+package limit
+
+type (
+	// Limiter limits the calls per key, like per caller app, user or ip.
+	Limiter interface {
+		// Allow takes one quota of key, and returns false if over the limit.
+		Allow(key string) (bool, error)
+	}
+)
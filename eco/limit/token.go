@@ -0,0 +1,107 @@
+package limit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// the buckets kept at most, the least recently used ones are evicted beyond it
+const maxKeys = 10000
+
+type (
+	// TokenLimiter is the local token bucket limiter, rate tokens are added per second
+	// up to burst, and each call takes one.
+	TokenLimiter struct {
+		rate    float64
+		burst   float64
+		maxKeys int
+		lock    sync.Mutex
+		buckets map[string]*list.Element
+		// the buckets, the least recently used at the back
+		lru *list.List
+	}
+
+	tokenBucket struct {
+		key      string
+		tokens   float64
+		lastTime time.Time
+	}
+)
+
+// NewTokenLimiter creates a token bucket limiter, burst is rate if not positive.
+func NewTokenLimiter(rate float64, burst int64) *TokenLimiter {
+	if burst <= 0 {
+		burst = int64(rate)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: maxKeys,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (l *TokenLimiter) Allow(key string) (bool, error) {
+	now := time.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	el, ok := l.buckets[key]
+	if ok {
+		l.lru.MoveToFront(el)
+	} else {
+		l.evict(now)
+		el = l.lru.PushFront(&tokenBucket{
+			key:      key,
+			tokens:   l.burst,
+			lastTime: now,
+		})
+		l.buckets[key] = el
+	}
+
+	bucket := el.Value.(*tokenBucket)
+	bucket.refill(now, l.rate, l.burst)
+	if bucket.tokens < 1 {
+		return false, nil
+	}
+
+	bucket.tokens--
+	return true, nil
+}
+
+// evict removes the least recently used buckets that are full, which behave the same as the new ones,
+// and the least recently used ones anyway beyond maxKeys. Each bucket is removed once at most,
+// so it costs O(1) per call on average, even if the keys are sprayed.
+func (l *TokenLimiter) evict(now time.Time) {
+	for l.lru.Len() > 0 {
+		back := l.lru.Back()
+		bucket := back.Value.(*tokenBucket)
+		bucket.refill(now, l.rate, l.burst)
+		if bucket.tokens < l.burst && l.lru.Len() < l.maxKeys {
+			return
+		}
+
+		l.lru.Remove(back)
+		delete(l.buckets, bucket.key)
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	elapsed := now.Sub(b.lastTime).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens += elapsed * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.lastTime = now
+}
@@ -0,0 +1,50 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenLimiter(t *testing.T) {
+	l := NewTokenLimiter(100, 3)
+	for i := 0; i < 3; i++ {
+		allowed, err := l.Allow("a")
+		assert.Nil(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, _ := l.Allow("a")
+	assert.False(t, allowed)
+	// the keys are limited separately
+	allowed, _ = l.Allow("b")
+	assert.True(t, allowed)
+
+	time.Sleep(time.Millisecond * 20)
+	allowed, _ = l.Allow("a")
+	assert.True(t, allowed)
+}
+
+func TestTokenLimiterEvict(t *testing.T) {
+	l := NewTokenLimiter(1000, 1)
+	l.Allow("a")
+	l.Allow("b")
+	time.Sleep(time.Millisecond * 5)
+	// the full buckets are evicted by the new keys
+	l.Allow("c")
+	assert.Equal(t, 1, len(l.buckets))
+	assert.Equal(t, 1, l.lru.Len())
+
+	// the least recently used ones are evicted beyond maxKeys, even if not full
+	l = NewTokenLimiter(0.001, 1)
+	l.maxKeys = 2
+	l.Allow("a")
+	l.Allow("b")
+	l.Allow("a")
+	l.Allow("c")
+	assert.Equal(t, 2, len(l.buckets))
+	_, ok := l.buckets["b"]
+	assert.False(t, ok)
+	allowed, _ := l.Allow("a")
+	assert.False(t, allowed)
+}
@@ -0,0 +1,70 @@
+package limit
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+const keyPrefix = "onerpc:limit:"
+
+var (
+	// tells the members of the instances apart
+	nodeId = rand.New(rand.NewSource(time.Now().UnixNano())).Int63()
+
+	// the calls in the window are kept as the members of a sorted set scored by the time in microseconds
+	windowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", key, 0, now - window)
+if redis.call("ZCARD", key) >= limit then
+	return 0
+end
+redis.call("ZADD", key, now, ARGV[4])
+redis.call("PEXPIRE", key, math.ceil(window / 1000))
+return 1
+`)
+)
+
+type (
+	// WindowLimiter is the sliding window limiter backed by redis, shared by all the instances,
+	// at most limit calls are allowed in any window.
+	WindowLimiter struct {
+		client *redis.Client
+		limit  int64
+		window time.Duration
+		seq    uint64
+	}
+)
+
+// NewWindowLimiter creates a sliding window limiter with client, like the one from toolkit.InitRedis.
+func NewWindowLimiter(client *redis.Client, limit int64, window time.Duration) *WindowLimiter {
+	return &WindowLimiter{
+		client: client,
+		limit:  limit,
+		window: window,
+	}
+}
+
+func (l *WindowLimiter) Allow(key string) (bool, error) {
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	// unique in the same microsecond, across the instances as well
+	member := fmt.Sprintf("%d-%d-%d", now, atomic.AddUint64(&l.seq, 1), nodeId)
+	result, err := windowScript.Run(l.client, []string{keyPrefix + key},
+		now, int64(l.window/time.Microsecond), l.limit, member).Result()
+	if err != nil {
+		return false, err
+	}
+
+	allowed, ok := result.(int64)
+	if !ok {
+		return false, fmt.Errorf("limit: unexpected result %v", result)
+	}
+
+	return allowed == 1, nil
+}
@@ -0,0 +1,226 @@
+package load
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+const (
+	cpuInterval = time.Millisecond * 250
+	// the moving average of the cpu usage, the bigger beta is, the smoother the usage changes
+	cpuBeta = 0.95
+
+	cgroupV2CpuStat = "/sys/fs/cgroup/cpu.stat"
+	cgroupV2CpuMax  = "/sys/fs/cgroup/cpu.max"
+	cgroupV1Usage   = "/sys/fs/cgroup/cpuacct/cpuacct.usage"
+	cgroupV1Quota   = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupV1Period  = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+	procStat        = "/proc/stat"
+)
+
+var (
+	cpuUsage int64
+	cpuOnce  sync.Once
+)
+
+type (
+	// cpuSampler reads the accumulated cpu time of the container, or the host without cgroup.
+	cpuSampler interface {
+		// sample returns the busy and the total cpu time, in any unit but the same.
+		sample() (busy, total uint64, err error)
+	}
+
+	cgroupSampler struct {
+		usage func() (uint64, error)
+		cores float64
+	}
+
+	procSampler struct{}
+)
+
+// CpuUsage returns the cpu usage of the process in millicpu, from 0 to 1000, of all the cores available.
+func CpuUsage() int64 {
+	startCpuSampling()
+	return atomic.LoadInt64(&cpuUsage)
+}
+
+func startCpuSampling() {
+	cpuOnce.Do(func() {
+		sampler, err := newCpuSampler()
+		if err != nil {
+			oc.LogErrorc("load", err, "fail to sample cpu usage, load shedding by cpu is disabled")
+			return
+		}
+
+		go runCpuSampling(sampler)
+	})
+}
+
+func runCpuSampling(sampler cpuSampler) {
+	ticker := time.NewTicker(cpuInterval)
+	defer ticker.Stop()
+
+	var usage float64
+	prevBusy, prevTotal, _ := sampler.sample()
+	for range ticker.C {
+		busy, total, err := sampler.sample()
+		if err != nil || total <= prevTotal {
+			continue
+		}
+
+		current := float64(busy-prevBusy) * 1000 / float64(total-prevTotal)
+		if current > 1000 {
+			current = 1000
+		}
+		usage = usage*cpuBeta + current*(1-cpuBeta)
+		atomic.StoreInt64(&cpuUsage, int64(usage))
+		prevBusy, prevTotal = busy, total
+	}
+}
+
+func newCpuSampler() (cpuSampler, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("cpu sampling only supported on linux")
+	}
+
+	if _, err := os.Stat(cgroupV2CpuStat); err == nil {
+		return &cgroupSampler{
+			usage: cgroupV2Usage,
+			cores: cgroupV2Cores(),
+		}, nil
+	}
+	if _, err := os.Stat(cgroupV1Usage); err == nil {
+		return &cgroupSampler{
+			usage: func() (uint64, error) {
+				// nanoseconds to microseconds
+				usage, err := readUint(cgroupV1Usage)
+				return usage / 1000, err
+			},
+			cores: cgroupV1Cores(),
+		}, nil
+	}
+	if _, err := os.Stat(procStat); err == nil {
+		return procSampler{}, nil
+	}
+
+	return nil, errors.New("no cgroup or procfs found")
+}
+
+// sample returns the cpu time used in microseconds, and the wall time of the cores in microseconds.
+func (s *cgroupSampler) sample() (uint64, uint64, error) {
+	usage, err := s.usage()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return usage, uint64(float64(time.Now().UnixNano()/int64(time.Microsecond)) * s.cores), nil
+}
+
+// sample returns the busy and total jiffies of the host.
+func (procSampler) sample() (uint64, uint64, error) {
+	content, err := ioutil.ReadFile(procStat)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var total, idle uint64
+		for i, field := range fields[1:] {
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			total += val
+			// idle and iowait
+			if i == 3 || i == 4 {
+				idle += val
+			}
+		}
+
+		return total - idle, total, nil
+	}
+
+	return 0, 0, errors.New("no cpu line in " + procStat)
+}
+
+func cgroupV2Usage() (uint64, error) {
+	content, err := ioutil.ReadFile(cgroupV2CpuStat)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	return 0, errors.New("no usage_usec in " + cgroupV2CpuStat)
+}
+
+func cgroupV2Cores() float64 {
+	// like "max 100000" or "200000 100000"
+	content, err := ioutil.ReadFile(cgroupV2CpuMax)
+	if err != nil {
+		return float64(runtime.NumCPU())
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) != 2 || fields[0] == "max" {
+		return float64(runtime.NumCPU())
+	}
+
+	return quotaCores(fields[0], fields[1])
+}
+
+func cgroupV1Cores() float64 {
+	quota, err := ioutil.ReadFile(cgroupV1Quota)
+	if err != nil {
+		return float64(runtime.NumCPU())
+	}
+	period, err := ioutil.ReadFile(cgroupV1Period)
+	if err != nil {
+		return float64(runtime.NumCPU())
+	}
+
+	return quotaCores(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func quotaCores(quota, period string) float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return float64(runtime.NumCPU())
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return float64(runtime.NumCPU())
+	}
+
+	return q / p
+}
+
+func readUint(file string) (uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
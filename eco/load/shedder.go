@@ -0,0 +1,184 @@
+package load
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+	"github.com/wednesdaysunny/onerpc/eco/inter/toolkit/window"
+)
+
+const (
+	// 100ms per bucket, 5s in total
+	windowSize     = 50
+	bucketDuration = time.Millisecond * 100
+	// the cpu usage in millicpu to start shedding
+	DefaultCpuThreshold = 900
+	// keep shedding for a while after dropped, even if the cpu cooled down, to avoid jittering
+	coolOffDuration = time.Second
+	// the moving average of the in-flight calls
+	flyingBeta = 0.9
+	// the min rt in milliseconds if no calls passed yet
+	defaultMinRt = 1000
+)
+
+type (
+	// Promise reports how the allowed call ended, one and only one of the methods should be called.
+	Promise interface {
+		// Pass marks the call finished, with the latency counted.
+		Pass()
+		// Fail marks the call failed because of overloading, like timed out, with the latency ignored.
+		Fail()
+	}
+
+	// Shedder is the adaptive load shedder like BBR, the calls are dropped when the cpu is over
+	// the threshold and the in-flight calls exceed the max throughput, which is estimated by
+	// the max passed calls per second multiplied by the min latency in the window.
+	Shedder struct {
+		cpuThreshold int64
+		cpuUsage     func() int64
+		// the buckets per second
+		buckets     int64
+		flying      int64
+		avgFlying   float64
+		flyingLock  sync.RWMutex
+		dropTime    int64
+		dropped     int32
+		passCounter *window.RollingWindow
+		rtCounter   *window.RollingWindow
+	}
+
+	promise struct {
+		start   time.Time
+		shedder *Shedder
+	}
+)
+
+// NewShedder creates a shedder, cpuThreshold is in millicpu, from 0 to 1000, DefaultCpuThreshold if not positive.
+func NewShedder(cpuThreshold int64) *Shedder {
+	if cpuThreshold <= 0 {
+		cpuThreshold = DefaultCpuThreshold
+	}
+
+	return &Shedder{
+		cpuThreshold: cpuThreshold,
+		cpuUsage:     CpuUsage,
+		buckets:      int64(time.Second / bucketDuration),
+		passCounter:  window.NewRollingWindow(windowSize, bucketDuration),
+		rtCounter:    window.NewRollingWindow(windowSize, bucketDuration),
+	}
+}
+
+// Allow returns a promise if the call is allowed, otherwise ErrServerTooBusy.
+func (s *Shedder) Allow() (Promise, error) {
+	if s.shouldDrop() {
+		atomic.StoreInt64(&s.dropTime, time.Now().UnixNano())
+		atomic.StoreInt32(&s.dropped, 1)
+		return nil, std.ErrServerTooBusy
+	}
+
+	s.addFlying(1)
+
+	return &promise{
+		start:   time.Now(),
+		shedder: s,
+	}, nil
+}
+
+// Overloaded checks if the shedder is dropping the calls.
+func (s *Shedder) Overloaded() bool {
+	return s.cpuOverloaded() || s.stillHot()
+}
+
+// Flying returns the calls in flight.
+func (s *Shedder) Flying() int64 {
+	return atomic.LoadInt64(&s.flying)
+}
+
+func (s *Shedder) addFlying(delta int64) {
+	flying := atomic.AddInt64(&s.flying, delta)
+	// update the average on the calls finished, to let the average fall behind the current,
+	// so that the calls are not dropped by a sudden burst
+	if delta < 0 {
+		s.flyingLock.Lock()
+		s.avgFlying = s.avgFlying*flyingBeta + float64(flying)*(1-flyingBeta)
+		s.flyingLock.Unlock()
+	}
+}
+
+func (s *Shedder) highThroughput() bool {
+	flying := atomic.LoadInt64(&s.flying)
+	s.flyingLock.RLock()
+	avgFlying := s.avgFlying
+	s.flyingLock.RUnlock()
+	maxFlight := s.maxFlight()
+
+	return float64(flying) > maxFlight && avgFlying > maxFlight
+}
+
+func (s *Shedder) maxFlight() float64 {
+	// passed calls per second * min rt in seconds
+	return math.Max(1, float64(s.maxPass()*s.buckets)*(s.minRt()/1e3))
+}
+
+func (s *Shedder) maxPass() int64 {
+	var result float64 = 1
+	s.passCounter.Reduce(func(b *window.Bucket) {
+		if b.Sum > result {
+			result = b.Sum
+		}
+	})
+
+	return int64(result)
+}
+
+func (s *Shedder) minRt() float64 {
+	var result float64 = defaultMinRt
+	s.rtCounter.Reduce(func(b *window.Bucket) {
+		if b.Count <= 0 {
+			return
+		}
+
+		avg := math.Round(b.Sum / float64(b.Count))
+		if avg < result {
+			result = avg
+		}
+	})
+
+	return result
+}
+
+func (s *Shedder) shouldDrop() bool {
+	return s.Overloaded() && s.highThroughput()
+}
+
+func (s *Shedder) cpuOverloaded() bool {
+	return s.cpuUsage() >= s.cpuThreshold
+}
+
+func (s *Shedder) stillHot() bool {
+	if atomic.LoadInt32(&s.dropped) == 0 {
+		return false
+	}
+
+	dropTime := atomic.LoadInt64(&s.dropTime)
+	if time.Since(time.Unix(0, dropTime)) < coolOffDuration {
+		return true
+	}
+
+	atomic.CompareAndSwapInt32(&s.dropped, 1, 0)
+	return false
+}
+
+func (p *promise) Pass() {
+	rt := float64(time.Since(p.start)) / float64(time.Millisecond)
+	p.shedder.addFlying(-1)
+	p.shedder.rtCounter.Add(math.Ceil(rt))
+	p.shedder.passCounter.Add(1)
+}
+
+func (p *promise) Fail() {
+	p.shedder.addFlying(-1)
+}
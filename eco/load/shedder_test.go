@@ -0,0 +1,82 @@
+package load
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	std "github.com/wednesdaysunny/onerpc/eco/inter"
+)
+
+func newTestShedder(cpu *int64) *Shedder {
+	s := NewShedder(800)
+	s.cpuUsage = func() int64 {
+		return *cpu
+	}
+	return s
+}
+
+func TestShedderCpuNotOverloaded(t *testing.T) {
+	cpu := int64(500)
+	s := newTestShedder(&cpu)
+
+	var promises []Promise
+	for i := 0; i < 100; i++ {
+		promise, err := s.Allow()
+		assert.Nil(t, err)
+		promises = append(promises, promise)
+	}
+	assert.Equal(t, int64(100), s.Flying())
+	for _, promise := range promises {
+		promise.Pass()
+	}
+	assert.Equal(t, int64(0), s.Flying())
+}
+
+func TestShedderDrop(t *testing.T) {
+	cpu := int64(950)
+	s := newTestShedder(&cpu)
+	// 10 calls per bucket with 10ms latency, 100 calls per second, max flight is 1
+	for i := 0; i < 10; i++ {
+		s.passCounter.Add(1)
+		s.rtCounter.Add(10)
+	}
+	s.avgFlying = 10
+	allowN := func(n int) []Promise {
+		var promises []Promise
+		for i := 0; i < n; i++ {
+			if promise, err := s.Allow(); err == nil {
+				promises = append(promises, promise)
+			}
+		}
+		return promises
+	}
+
+	promises := allowN(5)
+	assert.Equal(t, 2, len(promises))
+	_, err := s.Allow()
+	assert.Equal(t, std.ErrServerTooBusy, err)
+	assert.True(t, s.Overloaded())
+
+	// still hot after the cpu cooled down
+	cpu = 100
+	assert.True(t, s.stillHot())
+	_, err = s.Allow()
+	assert.Equal(t, std.ErrServerTooBusy, err)
+
+	s.dropTime = time.Now().Add(-coolOffDuration).UnixNano()
+	assert.False(t, s.Overloaded())
+	_, err = s.Allow()
+	assert.Nil(t, err)
+
+	for _, promise := range promises {
+		promise.Fail()
+	}
+}
+
+func TestQuotaCores(t *testing.T) {
+	assert.Equal(t, float64(2), quotaCores("200000", "100000"))
+	assert.Equal(t, 0.5, quotaCores("50000", "100000"))
+	assert.True(t, quotaCores("-1", "100000") >= 1)
+	assert.True(t, quotaCores("bad", "100000") >= 1)
+}
@@ -8,26 +8,37 @@ import (
 	"strings"
 	"time"
 
-
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
 	dialTimeout = time.Second * 3
 	separator   = '/'
+	// spread the calls over all the resolved addresses instead of sticking to the first one
+	defaultServiceConfig = `{"loadBalancingPolicy":"round_robin"}`
 )
 
 type (
 	ClientOptions struct {
-		PoolSize    int
-		Timeout     time.Duration
-		DialOptions []grpc.DialOption
+		PoolSize       int
+		PoolPolicy     string
+		Timeout        time.Duration
+		StreamTimeout  time.Duration
+		StreamIdle     time.Duration
+		DisableBreaker bool
+		BreakerCodes   []codes.Code
+		Retries        map[string]interceptor.RetryPolicy
+		Hedges         map[string]interceptor.HedgingPolicy
+		Credentials    credentials.TransportCredentials
+		DialOptions    []grpc.DialOption
 	}
 
 	ClientOption func(options *ClientOptions)
 
 	client struct {
-		conn *grpc.ClientConn
+		pool *connPool
 	}
 )
 
@@ -40,27 +51,53 @@ func NewClient(target string, opts ...ClientOption) (*client, error) {
 	return &cli, nil
 }
 
+// Conn returns one connection of the pool, prefer ClientConn to spread the calls over the whole pool.
 func (c *client) Conn() *grpc.ClientConn {
-	return c.conn
+	return c.pool.Conn()
 }
 
-func (c *client) buildDialOptions(opts ...ClientOption) []grpc.DialOption {
-	var cliOpts ClientOptions
-	for _, opt := range opts {
-		opt(&cliOpts)
-	}
+// ClientConn returns the pool as the connection used by the generated stubs.
+func (c *client) ClientConn() grpc.ClientConnInterface {
+	return c.pool
+}
+
+func (c *client) Close() {
+	c.pool.Close()
+}
 
+func (c *client) buildDialOptions(target string, cliOpts ClientOptions) []grpc.DialOption {
 	options := []grpc.DialOption{
-		grpc.WithInsecure(),
+		grpc.WithDefaultServiceConfig(defaultServiceConfig),
+	}
+	if cliOpts.Credentials != nil {
+		options = append(options, grpc.WithTransportCredentials(cliOpts.Credentials))
+	} else {
+		options = append(options, grpc.WithInsecure())
 	}
 	{
 		var (
 			unary   []grpc.UnaryClientInterceptor
 			streams []grpc.StreamClientInterceptor
 		)
+		// rebuild the Errs last, so that the other interceptors see the grpc codes
+		unary = append(unary, interceptor.ClientErrorInterceptor)
+		streams = append(streams, interceptor.StreamClientErrorInterceptor)
+		// the breaker goes first, so that the dropped calls fail fast
+		if !cliOpts.DisableBreaker {
+			unary = append(unary, interceptor.BreakerInterceptor(target, cliOpts.BreakerCodes))
+			streams = append(streams, interceptor.StreamBreakerInterceptor(target, cliOpts.BreakerCodes))
+		}
 		if cliOpts.Timeout > 0 {
 			unary = append(unary, interceptor.ClientTimeoutInterceptor(cliOpts.Timeout))
 		}
+		if cliOpts.StreamTimeout > 0 || cliOpts.StreamIdle > 0 {
+			streams = append(streams, interceptor.StreamClientTimeoutInterceptor(cliOpts.StreamIdle, cliOpts.StreamTimeout))
+		}
+		// retry after the timeout, so that all the attempts share the deadline,
+		// and before the metrics and tracing, so that each attempt is recorded
+		if len(cliOpts.Retries) > 0 {
+			unary = append(unary, interceptor.RetryInterceptor(target, cliOpts.Retries))
+		}
 		promUnary, promStream := interceptor.GetPrometheusClientInterceptors()
 		if len(promUnary) > 0 && len(promStream) > 0 {
 			unary = append(unary, promUnary...)
@@ -70,6 +107,10 @@ func (c *client) buildDialOptions(opts ...ClientOption) []grpc.DialOption {
 		if traceUnary := interceptor.ClientInterceptor(); traceUnary != nil {
 			unary = append(unary, traceUnary)
 		}
+		if traceStream := interceptor.StreamClientTracingInterceptor(); traceStream != nil {
+			streams = append(streams, traceStream)
+		}
+		streams = append(streams, interceptor.StreamClientLoggingInterceptor(target))
 
 		if len(unary) > 0 {
 			options = append(options, grpc.WithChainUnaryInterceptor(unary...))
@@ -83,7 +124,28 @@ func (c *client) buildDialOptions(opts ...ClientOption) []grpc.DialOption {
 }
 
 func (c *client) dial(server string, opts ...ClientOption) error {
-	options := c.buildDialOptions(opts...)
+	var cliOpts ClientOptions
+	for _, opt := range opts {
+		opt(&cliOpts)
+	}
+
+	options := c.buildDialOptions(server, cliOpts)
+	pool, err := newConnPool(cliOpts.PoolSize, cliOpts.PoolPolicy, func() (*grpc.ClientConn, error) {
+		return dialConn(server, options)
+	})
+	if err != nil {
+		return err
+	}
+	// hedged over the connections of the pool instead of by the interceptors of a connection
+	pool.target = server
+	pool.hedges = cliOpts.Hedges
+	pool.timeout = cliOpts.Timeout
+
+	c.pool = pool
+	return nil
+}
+
+func dialConn(server string, options []grpc.DialOption) (*grpc.ClientConn, error) {
 	timeCtx, cancel := context.WithTimeout(context.Background(), dialTimeout)
 	defer cancel()
 	conn, err := grpc.DialContext(timeCtx, server, options...)
@@ -96,12 +158,11 @@ func (c *client) dial(server string, opts ...ClientOption) error {
 				service = server[pos+1:]
 			}
 		}
-		return fmt.Errorf("rpc dial: %s, error: %s, make sure rpc service %q is alread started",
+		return nil, fmt.Errorf("rpc dial: %s, error: %s, make sure rpc service %q is alread started",
 			server, err.Error(), service)
 	}
 
-	c.conn = conn
-	return nil
+	return conn, nil
 }
 
 func WithDialOption(opt grpc.DialOption) ClientOption {
@@ -116,8 +177,72 @@ func WithTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
+// WithStreamTimeout cancels the streams lasting longer than timeout, or going idle longer than idle,
+// zero for no timeout.
+func WithStreamTimeout(timeout, idle time.Duration) ClientOption {
+	return func(options *ClientOptions) {
+		options.StreamTimeout = timeout
+		options.StreamIdle = idle
+	}
+}
+
 func WithPollSize(size int) ClientOption {
 	return func(options *ClientOptions) {
 		options.PoolSize = size
 	}
 }
+
+// WithTransportCredentials secures the connections, they are insecure by default.
+func WithTransportCredentials(creds credentials.TransportCredentials) ClientOption {
+	return func(options *ClientOptions) {
+		options.Credentials = creds
+	}
+}
+
+// WithoutBreaker disables the client side breaker, which is enabled by default.
+func WithoutBreaker() ClientOption {
+	return func(options *ClientOptions) {
+		options.DisableBreaker = true
+	}
+}
+
+// WithBreakerCodes sets the codes counted as the breaker failures, like Internal,
+// default are DeadlineExceeded, Unavailable and DataLoss.
+func WithBreakerCodes(failureCodes ...codes.Code) ClientOption {
+	return func(options *ClientOptions) {
+		options.BreakerCodes = failureCodes
+	}
+}
+
+// WithRetry retries the failed calls of method, use interceptor.AnyMethod to match all the methods.
+// Only set it on the idempotent methods.
+func WithRetry(method string, policy interceptor.RetryPolicy) ClientOption {
+	return func(options *ClientOptions) {
+		if options.Retries == nil {
+			options.Retries = make(map[string]interceptor.RetryPolicy)
+		}
+		options.Retries[method] = policy
+	}
+}
+
+// WithHedging sends up to maxHedges duplicates of the calls of method, one after another each time
+// the previous one hasn't answered within delay, each on another connection of the pool if any, so
+// set the pool size above 1. The attempts share the timeout. Only set it on the idempotent methods.
+func WithHedging(method string, delay time.Duration, maxHedges int) ClientOption {
+	return func(options *ClientOptions) {
+		if options.Hedges == nil {
+			options.Hedges = make(map[string]interceptor.HedgingPolicy)
+		}
+		options.Hedges[method] = interceptor.HedgingPolicy{
+			Delay:     delay,
+			MaxHedges: maxHedges,
+		}
+	}
+}
+
+// WithPoolPolicy sets how the calls are spread over the pool, PoolRoundRobin or PoolLeastInflight.
+func WithPoolPolicy(policy string) ClientOption {
+	return func(options *ClientOptions) {
+		options.PoolPolicy = policy
+	}
+}
@@ -0,0 +1,309 @@
+package eco
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"github.com/wednesdaysunny/onerpc/eco/interceptor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	PoolRoundRobin    = "round_robin"
+	PoolLeastInflight = "least_inflight"
+
+	replaceBackoffBase = time.Second
+	replaceBackoffMax  = time.Second * 30
+)
+
+// replaceAfter is how long a connection of a new pool fails without getting ready before being replaced
+var replaceAfter = time.Second * 5
+
+type (
+	dialFunc func() (*grpc.ClientConn, error)
+
+	pooledConn struct {
+		conn     *grpc.ClientConn
+		inflight int64
+	}
+
+	// connPool spreads the calls over several connections to the same target,
+	// one HTTP/2 connection can only carry a limited number of concurrent streams.
+	// Each connection is watched, and replaced once shut down or failing for replaceAfter.
+	// The hedged calls send each attempt on a connection not tried yet by the call, if any.
+	connPool struct {
+		policy string
+		dial   dialFunc
+		lock   sync.RWMutex
+		conns  []*pooledConn
+		next   uint32
+		closed bool
+		// the failing time before replacing a connection
+		replaceAfter time.Duration
+		ctx          context.Context
+		cancel       context.CancelFunc
+		// the hedging policies of the methods, and the timeout shared by the attempts
+		target  string
+		hedges  map[string]interceptor.HedgingPolicy
+		timeout time.Duration
+	}
+)
+
+var _ grpc.ClientConnInterface = (*connPool)(nil)
+
+func newConnPool(size int, policy string, dial dialFunc) (*connPool, error) {
+	if size < 1 {
+		size = 1
+	}
+	switch policy {
+	case "":
+		policy = PoolRoundRobin
+	case PoolRoundRobin, PoolLeastInflight:
+	default:
+		return nil, fmt.Errorf("unknown pool policy %q", policy)
+	}
+
+	p := &connPool{
+		policy:       policy,
+		dial:         dial,
+		replaceAfter: replaceAfter,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for i := 0; i < size; i++ {
+		conn, err := dial()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+
+		p.conns = append(p.conns, &pooledConn{conn: conn})
+	}
+	for i, pc := range p.conns {
+		go p.watch(i, pc, 0)
+	}
+
+	return p, nil
+}
+
+func (p *connPool) Invoke(ctx context.Context, method string, args, reply interface{},
+	opts ...grpc.CallOption) error {
+	policy, ok := interceptor.HedgingPolicyOf(p.hedges, method)
+	if !ok {
+		return p.invoke(ctx, p.pick(nil), method, args, reply, opts...)
+	}
+
+	// all the attempts share the timeout
+	if p.timeout > 0 {
+		var cancel func()
+		ctx, cancel = interceptor.ShrinkDeadline(ctx, p.timeout)
+		defer cancel()
+	}
+
+	var (
+		lock  sync.Mutex
+		tried = make(map[*pooledConn]bool)
+	)
+	return interceptor.Hedge(ctx, p.target, method, policy, reply,
+		func(ctx context.Context, attempt int, reply interface{}) error {
+			lock.Lock()
+			pc := p.pick(tried)
+			tried[pc] = true
+			lock.Unlock()
+
+			return p.invoke(ctx, pc, method, args, reply, opts...)
+		})
+}
+
+func (p *connPool) invoke(ctx context.Context, pc *pooledConn, method string, args, reply interface{},
+	opts ...grpc.CallOption) error {
+	atomic.AddInt64(&pc.inflight, 1)
+	defer atomic.AddInt64(&pc.inflight, -1)
+
+	return pc.conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (p *connPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	pc := p.pick(nil)
+	atomic.AddInt64(&pc.inflight, 1)
+	stream, err := pc.conn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		atomic.AddInt64(&pc.inflight, -1)
+		return nil, err
+	}
+
+	// the context of a client stream is cancelled once the stream finishes
+	go func() {
+		<-stream.Context().Done()
+		atomic.AddInt64(&pc.inflight, -1)
+	}()
+
+	return stream, nil
+}
+
+// Conn returns one of the connections, picked by the pool policy.
+func (p *connPool) Conn() *grpc.ClientConn {
+	return p.pick(nil).conn
+}
+
+func (p *connPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	p.cancel()
+	for _, pc := range p.conns {
+		pc.conn.Close()
+	}
+}
+
+// pick picks a connection by the policy, the usable ones not in exclude first, then the other usable ones.
+func (p *connPool) pick(exclude map[*pooledConn]bool) *pooledConn {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if pc := p.pickUsable(exclude); pc != nil {
+		return pc
+	}
+	if len(exclude) > 0 {
+		if pc := p.pickUsable(nil); pc != nil {
+			return pc
+		}
+	}
+
+	// none is usable, let the connection itself wait for ready or fail the call
+	return p.conns[int(atomic.AddUint32(&p.next, 1))%len(p.conns)]
+}
+
+// pickUsable picks a usable connection not in exclude by the policy, nil if none, p.lock must be held.
+func (p *connPool) pickUsable(exclude map[*pooledConn]bool) *pooledConn {
+	var (
+		size   = len(p.conns)
+		picked = -1
+	)
+	switch p.policy {
+	case PoolLeastInflight:
+		var least int64
+		for i, pc := range p.conns {
+			if exclude[pc] || !isUsable(pc.conn) {
+				continue
+			}
+			if inflight := atomic.LoadInt64(&pc.inflight); picked < 0 || inflight < least {
+				picked = i
+				least = inflight
+			}
+		}
+	default:
+		start := int(atomic.AddUint32(&p.next, 1))
+		for i := 0; i < size; i++ {
+			if pc := p.conns[(start+i)%size]; !exclude[pc] && isUsable(pc.conn) {
+				picked = (start + i) % size
+				break
+			}
+		}
+	}
+
+	if picked < 0 {
+		return nil
+	}
+
+	return p.conns[picked]
+}
+
+// watch replaces the connection pc at idx once it is shut down, or fails without getting ready
+// for p.replaceAfter, attempts is the replacements of idx in a row without getting ready.
+func (p *connPool) watch(idx int, pc *pooledConn, attempts int) {
+	var failedSince time.Time
+	for {
+		state := pc.conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			failedSince = time.Time{}
+			attempts = 0
+		case connectivity.TransientFailure:
+			if failedSince.IsZero() {
+				failedSince = time.Now()
+			}
+		}
+		if state == connectivity.Shutdown ||
+			(!failedSince.IsZero() && time.Since(failedSince) >= p.replaceAfter) {
+			p.replace(idx, pc, attempts)
+			return
+		}
+
+		ctx, cancel := p.ctx, context.CancelFunc(func() {})
+		if !failedSince.IsZero() {
+			ctx, cancel = context.WithTimeout(p.ctx, p.replaceAfter-time.Since(failedSince))
+		}
+		pc.conn.WaitForStateChange(ctx, state)
+		cancel()
+		if p.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// replace dials a new connection for pc at idx, after a backoff by attempts, until succeeded or the pool closed.
+func (p *connPool) replace(idx int, pc *pooledConn, attempts int) {
+	for {
+		if backoff := replaceBackoff(attempts); backoff > 0 {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+		attempts++
+
+		conn, err := p.dial()
+		if err != nil {
+			oc.LogErrorc("rpc", err, "fail to replace the broken connection")
+			continue
+		}
+
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			conn.Close()
+			return
+		}
+		replaced := &pooledConn{conn: conn}
+		p.conns[idx] = replaced
+		p.lock.Unlock()
+
+		pc.conn.Close()
+		go p.watch(idx, replaced, attempts)
+		return
+	}
+}
+
+// replaceBackoff is 0 for the first attempt, then doubles from replaceBackoffBase up to replaceBackoffMax.
+func replaceBackoff(attempts int) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+
+	backoff := replaceBackoffBase
+	for i := 1; i < attempts && backoff < replaceBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > replaceBackoffMax {
+		backoff = replaceBackoffMax
+	}
+
+	return backoff
+}
+
+func isUsable(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
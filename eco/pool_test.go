@@ -0,0 +1,186 @@
+package eco
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"github.com/wednesdaysunny/onerpc/eco/interceptor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/peer"
+)
+
+func newTestPool(t *testing.T, size int, policy string) (*connPool, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := grpc.NewServer()
+	go server.Serve(lis)
+
+	pool, err := newConnPool(size, policy, func() (*grpc.ClientConn, error) {
+		return dialConn(lis.Addr().String(), []grpc.DialOption{grpc.WithInsecure()})
+	})
+	assert.Nil(t, err)
+
+	return pool, func() {
+		pool.Close()
+		server.Stop()
+	}
+}
+
+func TestConnPoolRoundRobin(t *testing.T) {
+	pool, cleanup := newTestPool(t, 3, "")
+	defer cleanup()
+
+	picked := make(map[*grpc.ClientConn]int)
+	for i := 0; i < 30; i++ {
+		picked[pool.Conn()]++
+	}
+	assert.Equal(t, 3, len(picked))
+	for _, count := range picked {
+		assert.Equal(t, 10, count)
+	}
+}
+
+func TestConnPoolLeastInflight(t *testing.T) {
+	pool, cleanup := newTestPool(t, 3, PoolLeastInflight)
+	defer cleanup()
+
+	pool.conns[0].inflight = 5
+	pool.conns[1].inflight = 1
+	pool.conns[2].inflight = 3
+	assert.Equal(t, pool.conns[1], pool.pick(nil))
+	assert.Equal(t, pool.conns[2], pool.pick(map[*pooledConn]bool{pool.conns[1]: true}))
+	// all excluded, picked as if none is
+	assert.Equal(t, pool.conns[1], pool.pick(map[*pooledConn]bool{
+		pool.conns[0]: true, pool.conns[1]: true, pool.conns[2]: true,
+	}))
+}
+
+func TestConnPoolHedging(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	var (
+		lock  sync.Mutex
+		peers = make(map[string]bool)
+	)
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		var req wrappers.StringValue
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		p, _ := peer.FromContext(stream.Context())
+		lock.Lock()
+		peers[p.Addr.String()] = true
+		last := len(peers) == 3
+		lock.Unlock()
+		if !last {
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		}
+
+		return stream.SendMsg(&wrappers.StringValue{Value: "hedge"})
+	}))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	pool, err := newConnPool(3, PoolRoundRobin, func() (*grpc.ClientConn, error) {
+		return dialConn(lis.Addr().String(), []grpc.DialOption{grpc.WithInsecure()})
+	})
+	assert.Nil(t, err)
+	defer pool.Close()
+	pool.hedges = map[string]interceptor.HedgingPolicy{
+		interceptor.AnyMethod: {Delay: time.Millisecond * 10, MaxHedges: 2},
+	}
+
+	var reply wrappers.StringValue
+	assert.Nil(t, pool.Invoke(context.Background(), "/pkg.Svc/Get", &wrappers.StringValue{}, &reply))
+	assert.Equal(t, "hedge", reply.Value)
+	// each attempt on another connection
+	lock.Lock()
+	assert.Equal(t, 3, len(peers))
+	lock.Unlock()
+}
+
+func TestConnPoolReplace(t *testing.T) {
+	pool, cleanup := newTestPool(t, 2, PoolRoundRobin)
+	defer cleanup()
+
+	broken := pool.conns[0].conn
+	broken.Close()
+
+	assert.Eventually(t, func() bool {
+		pool.lock.RLock()
+		defer pool.lock.RUnlock()
+		return pool.conns[0].conn != broken
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConnPoolReplaceFailing(t *testing.T) {
+	defer func(d time.Duration) {
+		replaceAfter = d
+	}(replaceAfter)
+	replaceAfter = time.Millisecond * 100
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := grpc.NewServer()
+	go server.Serve(lis)
+	var dials int32
+	pool, err := newConnPool(1, PoolRoundRobin, func() (*grpc.ClientConn, error) {
+		atomic.AddInt32(&dials, 1)
+		return dialConn(lis.Addr().String(), []grpc.DialOption{grpc.WithInsecure()})
+	})
+	assert.Nil(t, err)
+	defer pool.Close()
+
+	failing := pool.Conn()
+	assert.Eventually(t, func() bool {
+		return failing.GetState() == connectivity.Ready
+	}, time.Second, 10*time.Millisecond)
+	// ready connections are kept
+	time.Sleep(replaceAfter * 2)
+	assert.Equal(t, failing, pool.Conn())
+
+	server.Stop()
+	assert.Eventually(t, func() bool {
+		return pool.Conn() != failing
+	}, time.Second*2, 10*time.Millisecond)
+	assert.Equal(t, connectivity.Shutdown, failing.GetState())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+
+	// the failing replacements are backed off
+	time.Sleep(replaceBackoffBase / 2)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+
+	pool.Close()
+	time.Sleep(replaceAfter * 2)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+}
+
+func TestReplaceBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{attempts: 0, backoff: 0},
+		{attempts: 1, backoff: replaceBackoffBase},
+		{attempts: 2, backoff: replaceBackoffBase * 2},
+		{attempts: 3, backoff: replaceBackoffBase * 4},
+		{attempts: 10, backoff: replaceBackoffMax},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.backoff, replaceBackoff(test.attempts))
+	}
+}
+
+func TestConnPoolUnknownPolicy(t *testing.T) {
+	_, err := newConnPool(1, "random", nil)
+	assert.NotNil(t, err)
+}
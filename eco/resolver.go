@@ -0,0 +1,205 @@
+package eco
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/wednesdaysunny/onerpc/eco/discov"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	"google.golang.org/grpc/resolver"
+)
+
+type (
+	directBuilder struct{}
+
+	directResolver struct {
+		cc    resolver.ClientConn
+		lock  sync.Mutex
+		addrs []resolver.Address
+	}
+
+	discovBuilder struct{}
+
+	discovResolver struct {
+		cc       resolver.ClientConn
+		key      string
+		registry discov.Registry
+		lock     sync.Mutex
+		members  []string // the subset of the endpoints connected
+		stop     func()
+	}
+)
+
+func init() {
+	resolver.Register(&directBuilder{})
+	resolver.Register(&discovBuilder{})
+}
+
+func (d *directBuilder) Build(target resolver.Target, cc resolver.ClientConn,
+	opts resolver.BuildOptions) (resolver.Resolver, error) {
+	endpoints := ParseEndpoints(target.Endpoint)
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%s: no endpoints found in target %q", DirectScheme, target.Endpoint)
+	}
+
+	var addrs []resolver.Address
+	for _, endpoint := range endpoints {
+		addrs = append(addrs, resolver.Address{
+			Addr: endpoint,
+		})
+	}
+
+	r := &directResolver{
+		cc:    cc,
+		addrs: addrs,
+	}
+	r.update()
+
+	return r, nil
+}
+
+func (d *directBuilder) Scheme() string {
+	return DirectScheme
+}
+
+// ResolveNow feeds the endpoints to the balancer again, the list of a direct target never changes,
+// but the balancer asks for it when all the connections are broken.
+func (r *directResolver) ResolveNow(options resolver.ResolveNowOptions) {
+	r.update()
+}
+
+func (r *directResolver) Close() {
+}
+
+func (r *directResolver) update() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.cc.UpdateState(resolver.State{
+		Addresses: r.addrs,
+	})
+}
+
+func (d *discovBuilder) Build(target resolver.Target, cc resolver.ClientConn,
+	opts resolver.BuildOptions) (resolver.Resolver, error) {
+	key := strings.TrimSpace(target.Endpoint)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s: no service key found in target", DiscovScheme)
+	}
+
+	r := &discovResolver{
+		cc:       cc,
+		key:      key,
+		registry: discov.GetRegistry(),
+	}
+	stop, err := r.registry.Watch(key, r.update)
+	if err != nil {
+		return nil, err
+	}
+	r.stop = stop
+
+	return r, nil
+}
+
+func (d *discovBuilder) Scheme() string {
+	return DiscovScheme
+}
+
+func (r *discovResolver) ResolveNow(options resolver.ResolveNowOptions) {
+	endpoints, err := r.registry.Endpoints(r.key)
+	if err != nil {
+		oc.LogErrorc("discov", err, fmt.Sprintf("fail to resolve %s", r.key))
+		r.cc.ReportError(err)
+		return
+	}
+
+	r.update(endpoints)
+}
+
+func (r *discovResolver) Close() {
+	r.stop()
+}
+
+func (r *discovResolver) update(endpoints []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.members = keepSubset(r.members, endpoints, subsetSize)
+	var addrs []resolver.Address
+	for _, endpoint := range r.members {
+		addrs = append(addrs, resolver.Address{
+			Addr: endpoint,
+		})
+	}
+
+	r.cc.UpdateState(resolver.State{
+		Addresses: addrs,
+	})
+}
+
+// subset picks at most sub endpoints randomly, so that each client only connects to a part of a large cluster.
+func subset(set []string, sub int) []string {
+	if len(set) <= sub {
+		return set
+	}
+
+	picked := make([]string, len(set))
+	copy(picked, set)
+	rand.Shuffle(len(picked), func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+
+	return picked[:sub]
+}
+
+// keepSubset picks at most sub endpoints of set, keeping the members still in set,
+// and replacing the ones left randomly, so that the endpoint updates don't churn all the connections.
+func keepSubset(members, set []string, sub int) []string {
+	if len(set) <= sub {
+		return set
+	}
+
+	var (
+		kept   []string
+		others []string
+		inSet  = make(map[string]bool, len(set))
+		isKept = make(map[string]bool, len(members))
+	)
+	for _, endpoint := range set {
+		inSet[endpoint] = true
+	}
+	for _, member := range members {
+		if inSet[member] && !isKept[member] && len(kept) < sub {
+			isKept[member] = true
+			kept = append(kept, member)
+		}
+	}
+	for _, endpoint := range set {
+		if !isKept[endpoint] {
+			others = append(others, endpoint)
+		}
+	}
+
+	return append(kept, subset(others, sub-len(kept))...)
+}
+
+// ParseEndpoints splits the endpoint part of a target like direct:///a,b,c, blanks and duplicates are dropped.
+func ParseEndpoints(endpoint string) []string {
+	var (
+		endpoints []string
+		seen      = make(map[string]bool)
+	)
+	for _, val := range strings.Split(endpoint, EndpointSep) {
+		val = strings.TrimSpace(val)
+		if len(val) == 0 || seen[val] {
+			continue
+		}
+
+		seen[val] = true
+		endpoints = append(endpoints, val)
+	}
+
+	return endpoints
+}
@@ -0,0 +1,129 @@
+package eco
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+type mockedClientConn struct {
+	state resolver.State
+	calls int
+}
+
+func (m *mockedClientConn) UpdateState(state resolver.State) {
+	m.state = state
+	m.calls++
+}
+
+func (m *mockedClientConn) ReportError(err error) {
+}
+
+func (m *mockedClientConn) NewAddress(addresses []resolver.Address) {
+}
+
+func (m *mockedClientConn) NewServiceConfig(serviceConfig string) {
+}
+
+func (m *mockedClientConn) ParseServiceConfig(serviceConfigJSON string) *serviceconfig.ParseResult {
+	return nil
+}
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		expect   []string
+	}{
+		{
+			name:     "empty",
+			endpoint: "",
+			expect:   nil,
+		},
+		{
+			name:     "single",
+			endpoint: "localhost:8080",
+			expect:   []string{"localhost:8080"},
+		},
+		{
+			name:     "blanks and duplicates",
+			endpoint: "a:1, b:2,,a:1 ,c:3",
+			expect:   []string{"a:1", "b:2", "c:3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, ParseEndpoints(test.endpoint))
+		})
+	}
+}
+
+func TestDirectBuilder(t *testing.T) {
+	var (
+		builder directBuilder
+		cc      mockedClientConn
+	)
+	r, err := builder.Build(resolver.Target{
+		Scheme:   DirectScheme,
+		Endpoint: "a:1,b:2,c:3",
+	}, &cc, resolver.BuildOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []resolver.Address{{Addr: "a:1"}, {Addr: "b:2"}, {Addr: "c:3"}}, cc.state.Addresses)
+
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	assert.Equal(t, 2, cc.calls)
+	assert.Equal(t, 3, len(cc.state.Addresses))
+
+	_, err = builder.Build(resolver.Target{Scheme: DirectScheme}, &cc, resolver.BuildOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestSubset(t *testing.T) {
+	var set []string
+	for i := 0; i < 100; i++ {
+		set = append(set, fmt.Sprintf("10.0.0.%d:10010", i))
+	}
+
+	picked := subset(set, subsetSize)
+	assert.Equal(t, subsetSize, len(picked))
+	assert.Equal(t, len(picked), len(ParseEndpoints(strings.Join(picked, EndpointSep))))
+	assert.Equal(t, set[:10], subset(set[:10], subsetSize))
+}
+
+func TestKeepSubset(t *testing.T) {
+	var set []string
+	for i := 0; i < 100; i++ {
+		set = append(set, fmt.Sprintf("10.0.0.%d:10010", i))
+	}
+
+	members := keepSubset(nil, set, subsetSize)
+	assert.Equal(t, subsetSize, len(members))
+
+	// an endpoint not in the subset left, all the members are kept
+	inMembers := make(map[string]bool)
+	for _, member := range members {
+		inMembers[member] = true
+	}
+	var others []string
+	for _, endpoint := range set {
+		if !inMembers[endpoint] {
+			others = append(others, endpoint)
+		}
+	}
+	updated := append(append([]string{}, members...), others[1:]...)
+	assert.Equal(t, members, keepSubset(members, updated, subsetSize))
+
+	// a member left, only it is replaced
+	updated = append(append([]string{}, members[1:]...), others...)
+	next := keepSubset(members, updated, subsetSize)
+	assert.Equal(t, subsetSize, len(next))
+	assert.Equal(t, members[1:], next[:subsetSize-1])
+	assert.False(t, inMembers[next[subsetSize-1]])
+
+	assert.Equal(t, set[:10], keepSubset(members, set[:10], subsetSize))
+}
@@ -1,7 +1,20 @@
 package eco
 
 import (
+	"context"
+	"errors"
 	"net"
+	"sync"
+)
+
+var ErrServerStopped = errors.New("rpc server already stopped")
+
+var (
+	// the started servers not stopped yet, wrapped up and stopped on the process level graceful stop,
+	// by the listeners added once for all the servers
+	runningServers     = make(map[*rpcServer]struct{})
+	runningServersLock sync.Mutex
+	runningServersOnce sync.Once
 )
 
 type (
@@ -14,6 +27,14 @@ type (
 	rpcServer struct {
 		name string
 		*baseRpcServer
+		lock              sync.Mutex
+		stopping          bool
+		wrapUpOnce        sync.Once
+		stopOnce          sync.Once
+		stopErr           error
+		done              chan struct{}
+		wrapUpListeners   *listenerManager
+		shutdownListeners *listenerManager
 	}
 )
 
@@ -24,7 +45,10 @@ func NewRpcServer(address string, opts ...ServerOption) Server {
 	}
 
 	return &rpcServer{
-		baseRpcServer: newBaseRpcServer(address),
+		baseRpcServer:     newBaseRpcServer(address),
+		done:              make(chan struct{}),
+		wrapUpListeners:   new(listenerManager),
+		shutdownListeners: new(listenerManager),
 	}
 }
 
@@ -32,21 +56,131 @@ func (s *rpcServer) SetName(name string) {
 	s.name = name
 }
 
+// AddWrapUpListener adds fn to be called when the server starts to stop, before it stops accepting calls.
+func (s *rpcServer) AddWrapUpListener(fn func()) {
+	s.wrapUpListeners.addListener(fn)
+}
+
+// AddShutdownListener adds fn to be called after the server stopped.
+func (s *rpcServer) AddShutdownListener(fn func()) {
+	s.shutdownListeners.addListener(fn)
+}
+
 func (s *rpcServer) Start(register RegisterFn) error {
+	s.lock.Lock()
+	if s.stopping {
+		s.lock.Unlock()
+		return ErrServerStopped
+	}
+	s.lock.Unlock()
+
 	lis, err := net.Listen("tcp", s.address)
 	if err != nil {
 		return err
 	}
 
-	register(s.GetGrpcServer())
-	// we need to make sure all others are wrapped up
-	// so we do graceful stop at shutdown phase instead of wrap up phase
-	// TODO grace stop
-	shutdownCalled := AddShutdownListener(func() {
-		s.GetGrpcServer().GracefulStop()
-	})
-	err = s.GetGrpcServer().Serve(lis)
-	shutdownCalled()
+	server := s.buildGrpcServer()
+	register(server)
+
+	// stopped while building, Stop might not have seen the grpc server to stop
+	s.lock.Lock()
+	if s.stopping {
+		s.lock.Unlock()
+		lis.Close()
+		return ErrServerStopped
+	}
+	addRunningServer(s)
+	s.lock.Unlock()
+
+	err = server.Serve(lis)
+
+	s.lock.Lock()
+	stopping := s.stopping
+	s.lock.Unlock()
+	if stopping {
+		// Serve returns once the listener is closed, wait for the calls to drain
+		<-s.done
+		return nil
+	}
 
 	return err
 }
+
+// Stop wraps up, stops accepting connections, and waits for the in-flight calls to finish,
+// the calls still running when ctx is done are closed by force, then the shutdown listeners are called.
+func (s *rpcServer) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		s.lock.Lock()
+		s.stopping = true
+		s.lock.Unlock()
+		removeRunningServer(s)
+
+		s.wrapUp()
+
+		// not started yet, nothing to drain
+		if server := s.GetGrpcServer(); server != nil {
+			drained := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(drained)
+			}()
+			select {
+			case <-drained:
+			case <-ctx.Done():
+				server.Stop()
+				<-drained
+				s.stopErr = ctx.Err()
+			}
+		}
+
+		s.shutdownListeners.notifyListeners()
+		close(s.done)
+	})
+
+	<-s.done
+	return s.stopErr
+}
+
+func (s *rpcServer) wrapUp() {
+	s.wrapUpOnce.Do(s.wrapUpListeners.notifyListeners)
+}
+
+// addRunningServer adds s to the running servers for the process level graceful stop, triggered by SIGTERM.
+// We need to make sure all others are wrapped up, so we do graceful stop at shutdown phase instead of
+// wrap up phase, and wrap up first, like to be NOT_SERVING, to stop the traffic as early as possible.
+func addRunningServer(s *rpcServer) {
+	runningServersOnce.Do(func() {
+		wrapUpListeners.addFirstListener(func() {
+			for _, server := range listRunningServers() {
+				server.wrapUp()
+			}
+		})
+		AddShutdownListener(func() {
+			for _, server := range listRunningServers() {
+				server.Stop(context.Background())
+			}
+		})
+	})
+
+	runningServersLock.Lock()
+	runningServers[s] = struct{}{}
+	runningServersLock.Unlock()
+}
+
+func removeRunningServer(s *rpcServer) {
+	runningServersLock.Lock()
+	delete(runningServers, s)
+	runningServersLock.Unlock()
+}
+
+func listRunningServers() []*rpcServer {
+	runningServersLock.Lock()
+	defer runningServersLock.Unlock()
+
+	servers := make([]*rpcServer, 0, len(runningServers))
+	for s := range runningServers {
+		servers = append(servers, s)
+	}
+
+	return servers
+}
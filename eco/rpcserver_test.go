@@ -0,0 +1,180 @@
+package eco
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func freeAddress(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// startSlowServer starts a server whose calls take delay, and returns the address and the result of Start.
+func startSlowServer(t *testing.T, delay time.Duration) (Server, string, chan error) {
+	address := freeAddress(t)
+	server := NewRpcServer(address)
+	server.SetGrpcServer(grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		time.Sleep(delay)
+		return handler(ctx, req)
+	})))
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start(func(s *grpc.Server) {
+			healthpb.RegisterHealthServer(s, health.NewServer())
+		})
+	}()
+
+	return server, address, started
+}
+
+func callHealth(t *testing.T, address string) chan error {
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+	assert.Nil(t, err)
+
+	result := make(chan error, 1)
+	go func() {
+		defer conn.Close()
+		_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		result <- err
+	}()
+
+	return result
+}
+
+func TestRpcServerStopDrains(t *testing.T) {
+	server, address, started := startSlowServer(t, time.Millisecond*200)
+	var calls []string
+	server.AddWrapUpListener(func() {
+		calls = append(calls, "wrapup")
+	})
+	server.AddShutdownListener(func() {
+		calls = append(calls, "shutdown")
+	})
+
+	result := callHealth(t, address)
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	assert.Nil(t, server.Stop(ctx))
+	assert.Nil(t, <-result)
+	assert.Nil(t, <-started)
+	assert.Equal(t, []string{"wrapup", "shutdown"}, calls)
+
+	// stopping again is a no-op, and a stopped server can't be started
+	assert.Nil(t, server.Stop(ctx))
+	assert.Equal(t, ErrServerStopped, server.Start(func(*grpc.Server) {}))
+}
+
+func TestRpcServerStopWhileStarting(t *testing.T) {
+	listeners := func() int {
+		wrapUpListeners.lock.Lock()
+		defer wrapUpListeners.lock.Unlock()
+		return len(wrapUpListeners.listeners)
+	}
+	before := listeners()
+
+	address := freeAddress(t)
+	server := NewRpcServer(address)
+	assert.Equal(t, ErrServerStopped, server.Start(func(*grpc.Server) {
+		assert.Nil(t, server.Stop(context.Background()))
+	}))
+	assert.Equal(t, before, listeners())
+
+	// the listener is released
+	lis, err := net.Listen("tcp", address)
+	assert.Nil(t, err)
+	lis.Close()
+}
+
+func TestRpcServerRunning(t *testing.T) {
+	listeners := func() int {
+		wrapUpListeners.lock.Lock()
+		defer wrapUpListeners.lock.Unlock()
+		return len(wrapUpListeners.listeners)
+	}
+	running := func(server Server) bool {
+		runningServersLock.Lock()
+		defer runningServersLock.Unlock()
+		_, ok := runningServers[server.(*rpcServer)]
+		return ok
+	}
+
+	var before int
+	for i := 0; i < 2; i++ {
+		server, _, started := startSlowServer(t, 0)
+		assert.Eventually(t, func() bool {
+			return running(server)
+		}, time.Second, time.Millisecond*10)
+		if i == 0 {
+			before = listeners()
+		}
+		// the global listeners are added once for all the servers
+		assert.Equal(t, before, listeners())
+
+		assert.Nil(t, server.Stop(context.Background()))
+		assert.Nil(t, <-started)
+		assert.False(t, running(server))
+	}
+}
+
+func TestRpcServerStopForce(t *testing.T) {
+	server, address, started := startSlowServer(t, time.Second*3)
+	result := callHealth(t, address)
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, server.Stop(ctx))
+	assert.NotNil(t, <-result)
+	assert.Nil(t, <-started)
+}
+
+func TestRpcServerInterceptors(t *testing.T) {
+	var calls []string
+	tracer := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+
+	address := freeAddress(t)
+	server := NewRpcServer(address)
+	server.AddNamedUnaryInterceptor("logging", tracer("logging"))
+	server.AddNamedUnaryInterceptor("cache", tracer("cache"))
+	server.AddNamedUnaryInterceptor("cache", tracer("cache2"))
+	server.AddUnaryInterceptors(tracer("user"))
+	assert.True(t, server.ReplaceUnaryInterceptor("logging", tracer("mylogging")))
+	assert.True(t, server.HasInterceptor("cache"))
+	assert.True(t, server.RemoveInterceptor("cache"))
+	assert.False(t, server.HasInterceptor("cache"))
+	assert.False(t, server.RemoveInterceptor("unknown"))
+	assert.False(t, server.ReplaceUnaryInterceptor("unknown", tracer("unknown")))
+	assert.Nil(t, server.GetGrpcServer())
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start(func(s *grpc.Server) {
+			healthpb.RegisterHealthServer(s, health.NewServer())
+		})
+	}()
+
+	assert.Nil(t, <-callHealth(t, address))
+	assert.Equal(t, []string{"mylogging", "user"}, calls)
+	assert.Nil(t, server.Stop(context.Background()))
+	assert.Nil(t, <-started)
+}
@@ -1,27 +1,54 @@
 package eco
 
 import (
+	"context"
+	"sync"
+
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
 	"google.golang.org/grpc"
 )
 
 type (
 	RegisterFn func(*grpc.Server)
 
+	// Server builds the grpc server lazily in Start, if not set by SetGrpcServer, with the options
+	// in the order added, then the unary and stream interceptors chained in the order added.
+	// The interceptors added after Start are ignored.
 	Server interface {
 		AddOptions(options ...grpc.ServerOption)
 		AddStreamInterceptors(interceptors ...grpc.StreamServerInterceptor)
 		AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor)
+		AddNamedStreamInterceptor(name string, interceptor grpc.StreamServerInterceptor)
+		AddNamedUnaryInterceptor(name string, interceptor grpc.UnaryServerInterceptor)
+		HasInterceptor(name string) bool
+		RemoveInterceptor(name string) bool
+		ReplaceStreamInterceptor(name string, interceptor grpc.StreamServerInterceptor) bool
+		ReplaceUnaryInterceptor(name string, interceptor grpc.UnaryServerInterceptor) bool
+		AddWrapUpListener(fn func())
+		AddShutdownListener(fn func())
 		SetName(string)
 		Start(register RegisterFn) error
+		Stop(ctx context.Context) error
 		SetGrpcServer(s *grpc.Server)
 		GetGrpcServer() *grpc.Server
 	}
 
+	namedUnaryInterceptor struct {
+		name        string
+		interceptor grpc.UnaryServerInterceptor
+	}
+
+	namedStreamInterceptor struct {
+		name        string
+		interceptor grpc.StreamServerInterceptor
+	}
+
 	baseRpcServer struct {
 		address            string
+		lock               sync.Mutex
 		options            []grpc.ServerOption
-		streamInterceptors []grpc.StreamServerInterceptor
-		unaryInterceptors  []grpc.UnaryServerInterceptor
+		streamInterceptors []namedStreamInterceptor
+		unaryInterceptors  []namedUnaryInterceptor
 		grpc               *grpc.Server
 	}
 )
@@ -33,21 +60,182 @@ func newBaseRpcServer(address string) *baseRpcServer {
 }
 
 func (s *baseRpcServer) AddOptions(options ...grpc.ServerOption) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.warnIfBuilt()
 	s.options = append(s.options, options...)
 }
 
 func (s *baseRpcServer) AddStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) {
-	s.streamInterceptors = append(s.streamInterceptors, interceptors...)
+	for _, interceptor := range interceptors {
+		s.AddNamedStreamInterceptor("", interceptor)
+	}
 }
 
 func (s *baseRpcServer) AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) {
-	s.unaryInterceptors = append(s.unaryInterceptors, interceptors...)
+	for _, interceptor := range interceptors {
+		s.AddNamedUnaryInterceptor("", interceptor)
+	}
+}
+
+// AddNamedStreamInterceptor adds the interceptor with name, so that it can be removed or replaced later,
+// multiple interceptors can share the same name.
+func (s *baseRpcServer) AddNamedStreamInterceptor(name string, interceptor grpc.StreamServerInterceptor) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.warnIfBuilt()
+	s.streamInterceptors = append(s.streamInterceptors, namedStreamInterceptor{
+		name:        name,
+		interceptor: interceptor,
+	})
+}
+
+// AddNamedUnaryInterceptor adds the interceptor with name, so that it can be removed or replaced later,
+// multiple interceptors can share the same name.
+func (s *baseRpcServer) AddNamedUnaryInterceptor(name string, interceptor grpc.UnaryServerInterceptor) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.warnIfBuilt()
+	s.unaryInterceptors = append(s.unaryInterceptors, namedUnaryInterceptor{
+		name:        name,
+		interceptor: interceptor,
+	})
+}
+
+// HasInterceptor checks if any unary or stream interceptor with name is added.
+func (s *baseRpcServer) HasInterceptor(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, item := range s.unaryInterceptors {
+		if len(name) > 0 && item.name == name {
+			return true
+		}
+	}
+	for _, item := range s.streamInterceptors {
+		if len(name) > 0 && item.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveInterceptor removes both the unary and stream interceptors with name, returns false if none found.
+func (s *baseRpcServer) RemoveInterceptor(name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.warnIfBuilt()
+
+	var found bool
+	unary := s.unaryInterceptors[:0]
+	for _, item := range s.unaryInterceptors {
+		if len(name) > 0 && item.name == name {
+			found = true
+		} else {
+			unary = append(unary, item)
+		}
+	}
+	s.unaryInterceptors = unary
+
+	stream := s.streamInterceptors[:0]
+	for _, item := range s.streamInterceptors {
+		if len(name) > 0 && item.name == name {
+			found = true
+		} else {
+			stream = append(stream, item)
+		}
+	}
+	s.streamInterceptors = stream
+
+	return found
+}
+
+// ReplaceStreamInterceptor replaces the stream interceptors with name by interceptor,
+// at the position of the first one, returns false if none found.
+func (s *baseRpcServer) ReplaceStreamInterceptor(name string, interceptor grpc.StreamServerInterceptor) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.warnIfBuilt()
+
+	var found bool
+	stream := s.streamInterceptors[:0]
+	for _, item := range s.streamInterceptors {
+		if len(name) == 0 || item.name != name {
+			stream = append(stream, item)
+		} else if !found {
+			found = true
+			stream = append(stream, namedStreamInterceptor{name: name, interceptor: interceptor})
+		}
+	}
+	s.streamInterceptors = stream
+
+	return found
+}
+
+// ReplaceUnaryInterceptor replaces the unary interceptors with name by interceptor,
+// at the position of the first one, returns false if none found.
+func (s *baseRpcServer) ReplaceUnaryInterceptor(name string, interceptor grpc.UnaryServerInterceptor) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.warnIfBuilt()
+
+	var found bool
+	unary := s.unaryInterceptors[:0]
+	for _, item := range s.unaryInterceptors {
+		if len(name) == 0 || item.name != name {
+			unary = append(unary, item)
+		} else if !found {
+			found = true
+			unary = append(unary, namedUnaryInterceptor{name: name, interceptor: interceptor})
+		}
+	}
+	s.unaryInterceptors = unary
+
+	return found
 }
 
 func (s *baseRpcServer) SetGrpcServer(sv *grpc.Server) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.grpc = sv
 }
 
+// GetGrpcServer returns the grpc server, which is nil before Start if not set by SetGrpcServer.
 func (s *baseRpcServer) GetGrpcServer() *grpc.Server {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return s.grpc
 }
+
+// buildGrpcServer builds the grpc server if not built or set yet.
+func (s *baseRpcServer) buildGrpcServer() *grpc.Server {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.grpc != nil {
+		return s.grpc
+	}
+
+	unary := make([]grpc.UnaryServerInterceptor, 0, len(s.unaryInterceptors))
+	for _, item := range s.unaryInterceptors {
+		unary = append(unary, item.interceptor)
+	}
+	stream := make([]grpc.StreamServerInterceptor, 0, len(s.streamInterceptors))
+	for _, item := range s.streamInterceptors {
+		stream = append(stream, item.interceptor)
+	}
+
+	// the chain options work together with the grpc.UnaryInterceptor and grpc.StreamInterceptor
+	// in the options, which are called before the chains
+	options := append([]grpc.ServerOption{}, s.options...)
+	options = append(options, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	s.grpc = grpc.NewServer(options...)
+
+	return s.grpc
+}
+
+func (s *baseRpcServer) warnIfBuilt() {
+	if s.grpc != nil {
+		oc.LogWarnc("server", nil, "grpc server already built, the options and interceptors take no effect")
+	}
+}
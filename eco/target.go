@@ -20,3 +20,7 @@ func BuildDirectTarget(endpoints []string) string {
 	return fmt.Sprintf("%s:///%s", DirectScheme,
 		strings.Join(endpoints, EndpointSep))
 }
+
+func BuildDiscovTarget(key string) string {
+	return fmt.Sprintf("%s:///%s", DiscovScheme, key)
+}
@@ -0,0 +1,116 @@
+package onerpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/wednesdaysunny/onerpc/eco/credential"
+	"github.com/wednesdaysunny/onerpc/eco/gateway"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+)
+
+// the in-flight http requests are waited at most for this long on wrapping up
+const gatewayStopTimeout = time.Second * 3
+
+// newGateway creates the gateway calling the server by its listen address, or the loopback if listening
+// on all the interfaces, so that the calls go through all the interceptors. The returned connection is
+// closed once the gateway stops. With TLS on, the server is dialed with the TLS conf of the gateway,
+// see gatewayTLS.
+func newGateway(c oconf.RpcServerConf) (*gateway.Gateway, *grpc.ClientConn, error) {
+	target, err := gatewayTarget(c.ListenOn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []grpc.DialOption{
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(defaultMsgSize), grpc.MaxCallSendMsgSize(defaultMsgSize)),
+	}
+	if c.TLS.Enabled() {
+		tc, err := gatewayTLS(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		creds, err := credential.NewClientTLS(tc)
+		if err != nil {
+			return nil, nil, err
+		}
+		options = append(options, grpc.WithTransportCredentials(creds))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+
+	// not blocking, the server is started later
+	conn, err := grpc.Dial(target, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gw, err := gateway.NewGateway(c.Gateway, conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return gw, conn, nil
+}
+
+// gatewayTLS returns the client side TLS conf of the gateway dialing the server. The certificate of the
+// server is never sent as the client one, it's not for the client auth, so the gateway needs its own TLS
+// conf if the server requires the client certificates, or only the CA and server_name of the server are used,
+// set server_name if the certificate doesn't cover the address.
+func gatewayTLS(c oconf.RpcServerConf) (oconf.TLSConf, error) {
+	if c.Gateway.TLS.Enabled() {
+		return c.Gateway.TLS, nil
+	}
+	if c.TLS.RequireClientCert {
+		return oconf.TLSConf{}, errors.New("gateway: tls of the gateway is required by require_client_cert")
+	}
+
+	return oconf.TLSConf{
+		CAFile:     c.TLS.CAFile,
+		ServerName: c.TLS.ServerName,
+	}, nil
+}
+
+// gatewayTarget returns the address the gateway dials to call the server listening on listenOn.
+func gatewayTarget(listenOn string) (string, error) {
+	host, port, err := net.SplitHostPort(listenOn)
+	if err != nil {
+		return "", err
+	}
+
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// startGateway routes the services registered on server, and serves the http requests in background.
+func (rs *RpcServer) startGateway(server *grpc.Server) {
+	if err := rs.gateway.Register(server.GetServiceInfo()); err != nil {
+		oc.LogErrorLn(err)
+		panic(err)
+	}
+
+	go func() {
+		if err := rs.gateway.Start(); err != nil {
+			oc.LogErrorc("gateway", err, "fail to serve the gateway")
+		}
+	}()
+}
+
+func (rs *RpcServer) stopGateway() {
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayStopTimeout)
+	defer cancel()
+	if err := rs.gateway.Stop(ctx); err != nil {
+		oc.LogErrorc("gateway", err, "fail to stop the gateway")
+	}
+	if err := rs.gwConn.Close(); err != nil {
+		oc.LogErrorc("gateway", err, "fail to close the gateway connection")
+	}
+}
@@ -0,0 +1,74 @@
+package onerpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestGatewayTarget(t *testing.T) {
+	tests := []struct {
+		listenOn string
+		target   string
+		err      bool
+	}{
+		{listenOn: ":8080", target: "127.0.0.1:8080"},
+		{listenOn: "0.0.0.0:8080", target: "127.0.0.1:8080"},
+		{listenOn: "[::]:8080", target: "127.0.0.1:8080"},
+		{listenOn: "10.0.0.1:8080", target: "10.0.0.1:8080"},
+		{listenOn: "[fe80::1]:8080", target: "[fe80::1]:8080"},
+		{listenOn: "rpc.local:8080", target: "rpc.local:8080"},
+		{listenOn: "8080", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.listenOn, func(t *testing.T) {
+			target, err := gatewayTarget(test.listenOn)
+			if test.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, test.target, target)
+		})
+	}
+}
+
+func TestGatewayTLS(t *testing.T) {
+	server := oconf.TLSConf{
+		CertFile:   "server.pem",
+		KeyFile:    "server.key",
+		CAFile:     "ca.pem",
+		ServerName: "rpc.local",
+	}
+	c := oconf.RpcServerConf{TLS: server}
+	tc, err := gatewayTLS(c)
+	assert.Nil(t, err)
+	// the server certificate is never sent as the client one
+	assert.Equal(t, oconf.TLSConf{CAFile: "ca.pem", ServerName: "rpc.local"}, tc)
+
+	c.TLS.RequireClientCert = true
+	_, err = gatewayTLS(c)
+	assert.NotNil(t, err)
+
+	c.Gateway.TLS = oconf.TLSConf{CertFile: "gateway.pem", KeyFile: "gateway.key", CAFile: "ca.pem"}
+	tc, err = gatewayTLS(c)
+	assert.Nil(t, err)
+	assert.Equal(t, c.Gateway.TLS, tc)
+}
+
+func TestStopGateway(t *testing.T) {
+	gw, conn, err := newGateway(oconf.RpcServerConf{
+		ListenOn: "127.0.0.1:0",
+		Gateway:  oconf.RestConf{Host: "127.0.0.1", Port: 1},
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	rs := &RpcServer{gateway: gw, gwConn: conn}
+	rs.stopGateway()
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+}
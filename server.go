@@ -1,18 +1,30 @@
 package onerpc
 
 import (
+	"context"
+	"fmt"
 	"github.com/wednesdaysunny/onerpc/eco"
+	"github.com/wednesdaysunny/onerpc/eco/credential"
+	"github.com/wednesdaysunny/onerpc/eco/discov"
+	"github.com/wednesdaysunny/onerpc/eco/gateway"
+	"github.com/wednesdaysunny/onerpc/eco/health"
 	"github.com/wednesdaysunny/onerpc/eco/interceptor"
+	"github.com/wednesdaysunny/onerpc/eco/ipfilter"
+	"github.com/wednesdaysunny/onerpc/eco/load"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	oc "github.com/wednesdaysunny/onerpc/eco/inter"
 	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"github.com/wednesdaysunny/onerpc/eco/inter/toolkit"
 	"github.com/wednesdaysunny/onerpc/eco/inter/toolkit/netutil"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"gopkg.in/redis.v5"
 )
 
 const (
@@ -20,14 +32,54 @@ const (
 	defaultMsgSize = 20971520 //20M
 )
 
-type RpcServer struct {
-	server   eco.Server
-	register eco.RegisterFn
-}
+// the names of the built-in interceptors, in the order of the chain,
+// which can be removed or replaced by RpcServer.RemoveInterceptor and RpcServer.Replace*Interceptor
+const (
+	InterceptorRecover    = "recover"
+	InterceptorLocalize   = "localize"
+	InterceptorIPFilter   = "ipfilter"
+	InterceptorShedding   = "shedding"
+	InterceptorLogging    = "logging"
+	InterceptorAuth       = "auth"
+	InterceptorRateLimit  = "ratelimit"
+	InterceptorPrometheus = "prometheus"
+	InterceptorTracing    = "tracing"
+	InterceptorSentry     = "sentry"
+	InterceptorValidate   = "validate"
+	InterceptorTimeout    = "timeout"
+	InterceptorError      = "error"
+	InterceptorCache      = "cache"
+)
+
+type (
+	RpcServer struct {
+		server   eco.Server
+		register eco.RegisterFn
+		name     string
+		listenOn string
+		registry discov.Registry
+		health   *health.Server
+		gateway  *gateway.Gateway
+		gwConn   *grpc.ClientConn // the loopback connection of the gateway
+		conf     oconf.RpcServerConf
+	}
+
+	namedUnaryInterceptor struct {
+		name        string
+		interceptor grpc.UnaryServerInterceptor
+	}
+
+	namedStreamInterceptor struct {
+		name        string
+		interceptor grpc.StreamServerInterceptor
+	}
+)
 
 func MustNewServer(c oconf.RpcServerConf, register eco.RegisterFn) *RpcServer {
 	{
-		interceptor.InitCache(c.RpcCacheRedis)
+		if err := interceptor.InitCache(c.RpcCacheRedis); err != nil {
+			log.Fatal(err)
+		}
 		interceptor.InitJaeger(oconf.GenServiceName(c.Name))
 	}
 	server, err := NewServer(c, register)
@@ -35,11 +87,12 @@ func MustNewServer(c oconf.RpcServerConf, register eco.RegisterFn) *RpcServer {
 		log.Fatal(err)
 	}
 
-	interceptor.InitPrometheusWithGrpcServer(server.GetGrpcServer())
-
 	return server
 }
 
+// NewServer creates the server, the grpc server is built in Start, with the options in the order of
+// the built-in ones then the ones added by AddOptions, and the interceptors chained in the order of
+// the built-in ones, see the Interceptor* names, then the ones added by Add*Interceptors.
 func NewServer(c oconf.RpcServerConf, register eco.RegisterFn) (*RpcServer, error) {
 	var (
 		err    error
@@ -49,19 +102,49 @@ func NewServer(c oconf.RpcServerConf, register eco.RegisterFn) (*RpcServer, erro
 	server = eco.NewRpcServer(c.ListenOn)
 
 	server.SetName(c.Name)
-	interceptors, err := BuildInterceptors(c)
+	server.AddOptions(grpc.MaxRecvMsgSize(defaultMsgSize), grpc.MaxSendMsgSize(defaultMsgSize))
+	if c.TLS.Enabled() {
+		creds, err := credential.NewServerTLS(c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		server.AddOptions(grpc.Creds(creds))
+	}
+
+	unary, streams, err := buildBuiltinInterceptors(c, func(stop func()) {
+		server.AddShutdownListener(stop)
+	})
 	if err != nil {
 		return nil, err
 	}
+	for _, item := range unary {
+		server.AddNamedUnaryInterceptor(item.name, item.interceptor)
+	}
+	for _, item := range streams {
+		server.AddNamedStreamInterceptor(item.name, item.interceptor)
+	}
 
 	rpcServer := &RpcServer{
 		server:   server,
 		register: register,
+		name:     c.Name,
+		listenOn: figureOutListenOn(c.ListenOn),
+		health:   health.NewServer(),
+		conf:     c,
 	}
-
-	{
-		grpcServer := grpc.NewServer(interceptors...)
-		rpcServer.SetGrpcServer(grpcServer)
+	// NOT_SERVING before anything else on wrapping up
+	server.AddWrapUpListener(rpcServer.health.Shutdown)
+	if c.Gateway.Port > 0 {
+		if rpcServer.gateway, rpcServer.gwConn, err = newGateway(c); err != nil {
+			return nil, err
+		}
+		// the http requests need the grpc server, stop them first
+		server.AddWrapUpListener(rpcServer.stopGateway)
+	}
+	if c.Discov.Enabled() {
+		if rpcServer.registry, err = discov.SetupRegistry(c.Discov); err != nil {
+			return nil, err
+		}
 	}
 
 	return rpcServer, nil
@@ -79,6 +162,28 @@ func (rs *RpcServer) AddUnaryInterceptors(interceptors ...grpc.UnaryServerInterc
 	rs.server.AddUnaryInterceptors(interceptors...)
 }
 
+// AddHealthChecker adds the dependency check with name to the health service,
+// like health.MysqlChecker and health.RedisChecker, the service is NOT_SERVING if any check failed.
+func (rs *RpcServer) AddHealthChecker(name string, checker health.Checker) {
+	rs.health.AddChecker(name, checker)
+}
+
+// RemoveInterceptor removes the unary and stream interceptors with name, like InterceptorCache.
+func (rs *RpcServer) RemoveInterceptor(name string) bool {
+	return rs.server.RemoveInterceptor(name)
+}
+
+// ReplaceStreamInterceptor replaces the stream interceptors with name, like InterceptorRecover.
+func (rs *RpcServer) ReplaceStreamInterceptor(name string, interceptor grpc.StreamServerInterceptor) bool {
+	return rs.server.ReplaceStreamInterceptor(name, interceptor)
+}
+
+// ReplaceUnaryInterceptor replaces the unary interceptors with name, like InterceptorLogging.
+func (rs *RpcServer) ReplaceUnaryInterceptor(name string, interceptor grpc.UnaryServerInterceptor) bool {
+	return rs.server.ReplaceUnaryInterceptor(name, interceptor)
+}
+
+// GetGrpcServer returns the grpc server, which is nil before Start if not set by SetGrpcServer.
 func (rs *RpcServer) GetGrpcServer() *grpc.Server {
 	return rs.server.GetGrpcServer()
 }
@@ -88,14 +193,42 @@ func (rs *RpcServer) SetGrpcServer(sv *grpc.Server) {
 }
 
 func (rs *RpcServer) Start() {
-	if err := rs.server.Start(rs.register); err != nil {
+	if rs.registry != nil {
+		if err := rs.registry.Register(rs.name, rs.listenOn); err != nil {
+			oc.LogErrorLn(err)
+			panic(err)
+		}
+		// deregister at wrap up phase, so that the clients stop sending requests before the server stops
+		rs.server.AddWrapUpListener(rs.deregister)
+	}
+	if err := rs.server.Start(func(server *grpc.Server) {
+		rs.register(server)
+		rs.health.Register(server)
+		if rs.conf.Reflection {
+			reflection.Register(server)
+		}
+		// the metrics and health status are initialized by the registered services
+		interceptor.InitPrometheusWithGrpcServer(server)
+		rs.health.Resume(server)
+		if rs.gateway != nil {
+			rs.startGateway(server)
+		}
+		rs.startAdmin()
+	}); err != nil {
 		oc.LogErrorLn(err)
 		panic(err)
 	}
 }
 
-func (rs *RpcServer) Stop() {
+// Stop stops the server, the in-flight calls are waited until ctx is done, see eco.Server.
+func (rs *RpcServer) Stop(ctx context.Context) error {
+	return rs.server.Stop(ctx)
+}
 
+func (rs *RpcServer) deregister() {
+	if err := rs.registry.Deregister(rs.name, rs.listenOn); err != nil {
+		oc.LogErrorc("discov", err, fmt.Sprintf("fail to deregister %s from %s", rs.listenOn, rs.name))
+	}
 }
 
 func figureOutListenOn(listenOn string) string {
@@ -120,47 +253,187 @@ func figureOutListenOn(listenOn string) string {
 	}
 }
 
+// BuildInterceptors builds the server options with the built-in interceptors chained,
+// for the ones building the grpc server themselves. The background work of the interceptors,
+// like reloading the ip lists, stops at the process shutdown, see BuildInterceptorsContext to stop it earlier.
 func BuildInterceptors(c oconf.RpcServerConf) ([]grpc.ServerOption, error) {
+	return buildInterceptors(c, func(stop func()) {
+		eco.AddShutdownListener(stop)
+	})
+}
+
+// BuildInterceptorsContext builds the server options like BuildInterceptors,
+// the background work of the interceptors stops once ctx is done.
+func BuildInterceptorsContext(ctx context.Context, c oconf.RpcServerConf) ([]grpc.ServerOption, error) {
+	return buildInterceptors(c, func(stop func()) {
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+	})
+}
+
+func buildInterceptors(c oconf.RpcServerConf, onStop func(stop func())) ([]grpc.ServerOption, error) {
+	unary, streams, err := buildBuiltinInterceptors(c, onStop)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		unaryChain  []grpc.UnaryServerInterceptor
+		streamChain []grpc.StreamServerInterceptor
+	)
+	for _, item := range unary {
+		unaryChain = append(unaryChain, item.interceptor)
+	}
+	for _, item := range streams {
+		streamChain = append(streamChain, item.interceptor)
+	}
+	options := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(defaultMsgSize),
+		grpc.MaxSendMsgSize(defaultMsgSize),
+		grpcmiddleware.WithUnaryServerChain(unaryChain...),
+		grpcmiddleware.WithStreamServerChain(streamChain...),
+	}
+
+	return options, nil
+}
 
+// buildBuiltinInterceptors builds the interceptors of c, onStop adds the funcs to stop their background work.
+func buildBuiltinInterceptors(c oconf.RpcServerConf, onStop func(stop func())) ([]namedUnaryInterceptor, []namedStreamInterceptor, error) {
 	var (
-		unary   []grpc.UnaryServerInterceptor
-		streams []grpc.StreamServerInterceptor
+		unary   []namedUnaryInterceptor
+		streams []namedStreamInterceptor
 	)
+	addUnary := func(name string, interceptors ...grpc.UnaryServerInterceptor) {
+		for _, item := range interceptors {
+			unary = append(unary, namedUnaryInterceptor{name: name, interceptor: item})
+		}
+	}
+	addStream := func(name string, interceptors ...grpc.StreamServerInterceptor) {
+		for _, item := range interceptors {
+			streams = append(streams, namedStreamInterceptor{name: name, interceptor: item})
+		}
+	}
+
 	{
-		unary = append(unary,
-			interceptor.RecoverInterceptorV2(),
-			interceptor.LoggingInterceptor,
-		)
-		streams = append(streams, grpcrecovery.StreamServerInterceptor(grpcrecovery.WithRecoveryHandler(func(p interface{}) (err error) {
+		addUnary(InterceptorRecover, interceptor.RecoverInterceptorV2())
+		addStream(InterceptorRecover, grpcrecovery.StreamServerInterceptor(grpcrecovery.WithRecoveryHandler(func(p interface{}) (err error) {
 			oc.LogRecover(p)
-			return oc.ErrInternal
+			// outside the error interceptor
+			return oc.ErrInternal.Status().Err()
 		})))
 	}
+	// right after the recover, so that the Errs of all the others are localized
+	if len(c.ErrorMessages) > 0 {
+		if err := oc.LoadMessages(c.ErrorMessages); err != nil {
+			return nil, nil, err
+		}
+		addUnary(InterceptorLocalize, interceptor.UnaryLocalizeInterceptor)
+		addStream(InterceptorLocalize, interceptor.StreamLocalizeInterceptor)
+	}
+	if c.IPFilter.Enabled() {
+		var client *redis.Client
+		if len(c.IPFilter.RedisKey) > 0 {
+			client = toolkit.InitRedis(c.Redis)
+		}
+		filter, err := ipfilter.NewFilter(c.IPFilter, client)
+		if err != nil {
+			return nil, nil, err
+		}
+		onStop(filter.Stop)
+		addUnary(InterceptorIPFilter, interceptor.UnaryIPFilterInterceptor(filter))
+		addStream(InterceptorIPFilter, interceptor.StreamIPFilterInterceptor(filter))
+	}
+	// shed the load before anything else, like logging, costs
+	if c.CpuThreshold > 0 {
+		shedder := load.NewShedder(c.CpuThreshold)
+		addUnary(InterceptorShedding, interceptor.UnarySheddingInterceptor(shedder))
+		addStream(InterceptorShedding, interceptor.StreamSheddingInterceptor(shedder))
+	}
+	addUnary(InterceptorLogging, interceptor.LoggingInterceptor)
+	addStream(InterceptorLogging, interceptor.StreamLoggingInterceptor)
+	if c.Auth {
+		authenticator := credential.NewAuthenticator(c.AuthApps, c.StrictControl)
+		addUnary(InterceptorAuth, interceptor.UnaryAuthorizeInterceptor(authenticator))
+		addStream(InterceptorAuth, interceptor.StreamAuthorizeInterceptor(authenticator))
+	}
+	if len(c.RateLimits) > 0 {
+		rules, err := interceptor.RateLimitRulesFromConf(c.RateLimits, rateLimitRedis(c), c.IPFilter.TrustedProxies)
+		if err != nil {
+			return nil, nil, err
+		}
+		addUnary(InterceptorRateLimit, interceptor.UnaryRateLimitInterceptor(rules))
+		addStream(InterceptorRateLimit, interceptor.StreamRateLimitInterceptor(rules))
+	}
 	{
 		mUnary, mStream := interceptor.GetPrometheusServerInterceptors()
 		if len(mUnary) > 0 && len(mStream) > 0 {
-			unary = append(unary, mUnary...)
-			streams = append(streams, mStream...)
+			addUnary(InterceptorPrometheus, mUnary...)
+			addStream(InterceptorPrometheus, mStream...)
 		}
 
 		if tUnary := interceptor.ServerInterceptor(oconf.GenServiceName(c.Name)); tUnary != nil {
-			unary = append(unary, tUnary)
+			addUnary(InterceptorTracing, tUnary)
+		}
+		if tStream := interceptor.StreamServerTracingInterceptor(oconf.GenServiceName(c.Name)); tStream != nil {
+			addStream(InterceptorTracing, tStream)
 		}
 	}
 	{
 		sentryUnaryInterceptor, sentryStreamInterceptor := interceptor.GetSentryServerInterceptors()
 		if len(sentryUnaryInterceptor) > 0 || len(sentryStreamInterceptor) > 0 {
-			unary = append(unary, sentryUnaryInterceptor...)
-			streams = append(streams, sentryStreamInterceptor...)
+			addUnary(InterceptorSentry, sentryUnaryInterceptor...)
+			addStream(InterceptorSentry, sentryStreamInterceptor...)
 		}
 	}
-	unary = append(unary, interceptor.CacheUnaryServerInterceptor())
-	options := []grpc.ServerOption{
-		grpc.MaxRecvMsgSize(defaultMsgSize),
-		grpc.MaxSendMsgSize(defaultMsgSize),
-		grpcmiddleware.WithUnaryServerChain(unary...),
-		grpcmiddleware.WithStreamServerChain(streams...),
+	if c.Validate {
+		addUnary(InterceptorValidate, interceptor.UnaryValidateInterceptor)
+		addStream(InterceptorValidate, interceptor.StreamValidateInterceptor)
+	}
+	// inside the metrics and tracing, so that the timeouts are seen
+	addUnary(InterceptorTimeout, interceptor.UnaryTimeoutInterceptor(serverTimeouts(c)))
+	if c.StreamTimeout > 0 || c.StreamIdle > 0 || len(c.Timeouts) > 0 {
+		idle, timeout, methods := streamTimeouts(c)
+		addStream(InterceptorTimeout, interceptor.StreamTimeoutInterceptor(idle, timeout, methods))
 	}
+	// outside the cache, so that the cached Errs are converted as well, the Errs of the outer ones,
+	// like the recover and the auth, are converted by themselves
+	addUnary(InterceptorError, interceptor.UnaryErrorInterceptor)
+	addStream(InterceptorError, interceptor.StreamErrorInterceptor)
+	addUnary(InterceptorCache, interceptor.CacheUnaryServerInterceptor())
 
-	return options, nil
+	return unary, streams, nil
+}
+
+// serverTimeouts returns the default timeout and the ones of the methods.
+func serverTimeouts(c oconf.RpcServerConf) (time.Duration, map[string]time.Duration) {
+	timeout := time.Duration(c.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = interceptor.DefaultServerTimeout
+	}
+
+	methods := make(map[string]time.Duration, len(c.Timeouts))
+	for method, t := range c.Timeouts {
+		methods[method] = time.Duration(t) * time.Millisecond
+	}
+
+	return timeout, methods
+}
+
+// streamTimeouts returns the idle timeout, the total timeout and the total ones of the methods of the streams.
+func streamTimeouts(c oconf.RpcServerConf) (time.Duration, time.Duration, map[string]time.Duration) {
+	_, methods := serverTimeouts(c)
+	return time.Duration(c.StreamIdle) * time.Second, time.Duration(c.StreamTimeout) * time.Second, methods
+}
+
+// rateLimitRedis connects the redis of the server if any rate limit is stored in redis.
+func rateLimitRedis(c oconf.RpcServerConf) *redis.Client {
+	for _, item := range c.RateLimits {
+		if item.Store == interceptor.RateLimitRedis {
+			return toolkit.InitRedis(c.Redis)
+		}
+	}
+
+	return nil
 }
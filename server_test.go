@@ -0,0 +1,72 @@
+package onerpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wednesdaysunny/onerpc/eco/credential"
+	oc "github.com/wednesdaysunny/onerpc/eco/inter"
+	oconf "github.com/wednesdaysunny/onerpc/eco/inter/conf"
+	"google.golang.org/grpc"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type panicService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (panicService) EmptyCall(ctx context.Context, in *testpb.Empty) (*testpb.Empty, error) {
+	panic("boom")
+}
+
+func TestBuildInterceptorsErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	options, err := BuildInterceptorsContext(ctx, oconf.RpcServerConf{
+		Name:          "errors",
+		Auth:          true,
+		AuthApps:      map[string]string{"order": "secret"},
+		StrictControl: true,
+		Timeout:       2,
+	})
+	assert.Nil(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := grpc.NewServer(options...)
+	testpb.RegisterTestServiceServer(server, panicService{})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := testpb.NewTestServiceClient(conn)
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		err  *oc.Err
+	}{
+		{name: "auth failure", md: metadata.Pairs(credential.AppKey, "order", credential.TokenKey, "guess"),
+			err: oc.ErrIllegalToken},
+		{name: "recovered panic", md: metadata.Pairs(credential.AppKey, "order", credential.TokenKey, "secret"),
+			err: oc.ErrInternal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := client.EmptyCall(metadata.NewOutgoingContext(context.Background(), test.md), &testpb.Empty{})
+			st := status.Convert(err)
+			assert.Equal(t, test.err.GrpcCode(), st.Code())
+			e, ok := oc.ErrFromStatus(st)
+			if assert.True(t, ok) {
+				assert.Equal(t, test.err.Code, e.Code)
+			}
+		})
+	}
+}